@@ -1,16 +1,20 @@
 const fs = require("fs")
 
+// copies of each animal in the official 56 card deck, every fruit card is single
+const animalRepeats = [2, 2, 2, 1, 1]
+
 function nameToType(name) {
     if (name.startsWith("animal-")) {
+        let variant = +name.substring("animal-".length)
         return {
             type: "animal",
-            repeat: 1,
-            variant: +name.substring("animal-".length)
+            repeat: animalRepeats[variant - 1],
+            variant
         }
     } else {
         let fruits = name.split("_").map(seg => {
             return {
-                variant: ["s", "p", "g", "b"].indexOf(seg.substring(1)),
+                variant: ["s", "p", "g", "b"].indexOf(seg.substring(1)) + 1,
                 number: +seg.substring(0, 1)
             }
         })
@@ -33,11 +37,11 @@ let lines = buffer.toString().split("\n")
     });
 
 let meta = {
-    fruits: ["草莓", "青梨", "葡萄", "香蕉"].map((name, index) => ({
-        name, variant: index + 1
+    fruits: [["草莓", "🍓"], ["青梨", "🍐"], ["葡萄", "🍇"], ["香蕉", "🍌"]].map(([name, emoji], index) => ({
+        name, variant: index + 1, emoji
     })),
-    animals: ["兔子", "梅花鹿", "猴子", "柴犬", "熊猫"].map((name, index) => ({
-        name, variant: index + 1
+    animals: [["兔子", "🐰"], ["梅花鹿", "🦌"], ["猴子", "🐒"], ["柴犬", "🐕"], ["熊猫", "🐼"]].map(([name, emoji], index) => ({
+        name, variant: index + 1, emoji
     }))
 }
 let result = JSON.stringify({ meta, cards: lines }, null, 4)
@@ -2,16 +2,15 @@ package assets
 
 import (
 	"encoding/json"
-	"halligalli/auth"
 	"halligalli/common"
 	"halligalli/env"
 	"os"
 )
 
-const AssetFilePath = "./asset.json"
+const DefaultAssetPath = "assets/asset.json"
 
-func LoadAssets() error {
-	content, err := os.ReadFile(auth.GetPath(AssetFilePath))
+func LoadAssets(path string) error {
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return err
 	}
@@ -40,3 +39,21 @@ func GetFruitNameByVariant(variant int) string {
 	}
 	return ""
 }
+
+func GetAnimalEmojiByVariant(variant int) string {
+	for _, animal := range env.GetContext().Asset.Meta.Animals {
+		if animal.Variant == variant {
+			return animal.Emoji
+		}
+	}
+	return ""
+}
+
+func GetFruitEmojiByVariant(variant int) string {
+	for _, fruit := range env.GetContext().Asset.Meta.Fruits {
+		if fruit.Variant == variant {
+			return fruit.Emoji
+		}
+	}
+	return ""
+}
@@ -2,44 +2,29 @@ package auth
 
 import (
 	"fmt"
-	"gopkg.in/yaml.v3"
 	"halligalli/common"
-	"halligalli/env"
-	"os"
-	"path"
-	"runtime"
+	"log/slog"
 )
 
-const ConfigFilePath = "./config.yaml"
+// DefaultTokenSource is set when the client secret is configured
+var DefaultTokenSource *AppAccessTokenSource
 
 func GetTokenString(token common.Token) string {
 	return fmt.Sprintf("%s %v.%s", "Bot", token.AppID, token.AccessToken)
 }
 
-func GetPath(name string) string {
-	_, filename, _, ok := runtime.Caller(1)
-	if ok {
-		return fmt.Sprintf("%s/%s", path.Dir(filename), name)
+// GetAuthorization prefers the app access token when the client secret is configured,
+// falling back to the legacy bot token
+func GetAuthorization(token common.Token) (string, error) {
+	if DefaultTokenSource != nil {
+		accessToken, err := DefaultTokenSource.AccessToken()
+		if err == nil {
+			return fmt.Sprintf("%s %s", "QQBot", accessToken), nil
+		}
+		if token.AccessToken == "" {
+			return "", err
+		}
+		slog.Error("getting app access token, falling back to bot token", "err", err)
 	}
-	return ""
-}
-
-func LoadTokenFromConfig() error {
-	var conf struct {
-		AppID uint64 `yaml:"appid"`
-		Token string `yaml:"token"`
-	}
-	content, err := os.ReadFile(GetPath(ConfigFilePath))
-	if err != nil {
-		return err
-	}
-	if err = yaml.Unmarshal(content, &conf); err != nil {
-		return err
-	}
-
-	env.GetContext().Token = common.Token{
-		AppID:       conf.AppID,
-		AccessToken: conf.Token,
-	}
-	return nil
+	return GetTokenString(token), nil
 }
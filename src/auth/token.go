@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	AppAccessTokenUrl = "https://bots.qq.com/app/getAppAccessToken"
+	// RefreshBeforeExpiry renews the access token while the current one is still valid
+	RefreshBeforeExpiry = time.Minute
+	// MinRefreshBackoff and MaxRefreshBackoff space out the retries of a failing refresh while the token is still valid
+	MinRefreshBackoff = time.Second
+	MaxRefreshBackoff = 15 * time.Second
+)
+
+type appAccessTokenRequest struct {
+	AppId        string `json:"appId"`
+	ClientSecret string `json:"clientSecret"`
+}
+
+type appAccessTokenResponse struct {
+	AccessToken string      `json:"access_token"`
+	ExpiresIn   json.Number `json:"expires_in"`
+	Code        int         `json:"code"`
+	Message     string      `json:"message"`
+}
+
+// AppAccessTokenSource exchanges the app id and client secret for an access token,
+// caching it until shortly before it expires
+type AppAccessTokenSource struct {
+	Url          string
+	AppID        uint64
+	ClientSecret string
+	// Now is replaceable for testing
+	Now         func() time.Time
+	client      *http.Client
+	lock        sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+	// refreshing is the fetch in flight, every caller without a valid token waits for it instead of fetching again
+	refreshing *tokenFetch
+	failures   int
+	retryAt    time.Time
+}
+
+type tokenFetch struct {
+	done        chan struct{}
+	accessToken string
+	err         error
+}
+
+func NewAppAccessTokenSource(url string, appId uint64, clientSecret string) *AppAccessTokenSource {
+	return &AppAccessTokenSource{
+		Url:          url,
+		AppID:        appId,
+		ClientSecret: clientSecret,
+		Now:          time.Now,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// AccessToken returns the cached token, refreshing it when it is about to expire,
+// the cached token is kept if refreshing fails while it is still valid.
+// The token is fetched outside the lock, callers with a valid token never wait for it.
+func (source *AppAccessTokenSource) AccessToken() (string, error) {
+	source.lock.Lock()
+	now := source.Now()
+	if source.accessToken != "" && now.Before(source.expiresAt) {
+		due := !now.Before(source.expiresAt.Add(-RefreshBeforeExpiry))
+		if !due || source.refreshing != nil || now.Before(source.retryAt) {
+			accessToken := source.accessToken
+			source.lock.Unlock()
+			return accessToken, nil
+		}
+	}
+	call := source.refreshing
+	if call != nil {
+		source.lock.Unlock()
+		<-call.done
+		return call.accessToken, call.err
+	}
+	call = &tokenFetch{done: make(chan struct{})}
+	source.refreshing = call
+	source.lock.Unlock()
+
+	accessToken, expiresIn, err := source.fetch()
+
+	source.lock.Lock()
+	now = source.Now()
+	if err == nil {
+		source.accessToken = accessToken
+		source.expiresAt = now.Add(expiresIn)
+		source.failures = 0
+		source.retryAt = time.Time{}
+		call.accessToken = accessToken
+	} else {
+		source.failures += 1
+		source.retryAt = now.Add(RefreshBackoff(source.failures))
+		if source.accessToken != "" && now.Before(source.expiresAt) {
+			call.accessToken = source.accessToken
+		} else {
+			call.err = err
+		}
+	}
+	source.refreshing = nil
+	source.lock.Unlock()
+	close(call.done)
+	return call.accessToken, call.err
+}
+
+// RefreshBackoff doubles the wait after each failed refresh in a row
+func RefreshBackoff(failures int) time.Duration {
+	backoff := MinRefreshBackoff
+	for i := 1; i < failures && backoff < MaxRefreshBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, MaxRefreshBackoff)
+}
+
+func (source *AppAccessTokenSource) fetch() (string, time.Duration, error) {
+	reqBody, err := json.Marshal(appAccessTokenRequest{
+		AppId:        strconv.FormatUint(source.AppID, 10),
+		ClientSecret: source.ClientSecret,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := source.client.Post(source.Url, "application/json", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", 0, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, err
+	}
+	if err = resp.Body.Close(); err != nil {
+		return "", 0, err
+	}
+
+	var body appAccessTokenResponse
+	if err = json.Unmarshal(respBody, &body); err != nil {
+		return "", 0, fmt.Errorf("parsing access token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", 0, fmt.Errorf("getting access token failed (status %d): %d %s", resp.StatusCode, body.Code, body.Message)
+	}
+	seconds, err := body.ExpiresIn.Int64()
+	if err != nil {
+		return "", 0, fmt.Errorf("parsing access token expiry %q: %w", body.ExpiresIn, err)
+	}
+	return body.AccessToken, time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"halligalli/common"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeTokenEndpoint struct {
+	// release holds every request back until it is closed, if it is not nil
+	release  chan bool
+	lock     sync.Mutex
+	issued   int
+	failing  bool
+	requests []appAccessTokenRequest
+}
+
+func (endpoint *fakeTokenEndpoint) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if endpoint.release != nil {
+		<-endpoint.release
+	}
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	var body appAccessTokenRequest
+	if err := json.NewDecoder(request.Body).Decode(&body); err != nil {
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	endpoint.requests = append(endpoint.requests, body)
+	if endpoint.failing || body.ClientSecret != "secret" {
+		writer.WriteHeader(http.StatusUnauthorized)
+		_, _ = fmt.Fprint(writer, `{"code":100016,"message":"invalid appid or secret"}`)
+		return
+	}
+	endpoint.issued += 1
+	// the OpenAPI gives the expiry as a string
+	_, _ = fmt.Fprintf(writer, `{"access_token":"token-%d","expires_in":"7200"}`, endpoint.issued)
+}
+
+func (endpoint *fakeTokenEndpoint) setFailing(failing bool) {
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	endpoint.failing = failing
+}
+
+func (endpoint *fakeTokenEndpoint) requestCount() int {
+	endpoint.lock.Lock()
+	defer endpoint.lock.Unlock()
+	return len(endpoint.requests)
+}
+
+func TestAppAccessTokenRefreshesBeforeExpiry(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	now := time.Now()
+	source := NewAppAccessTokenSource(server.URL, 1024, "secret")
+	source.Now = func() time.Time { return now }
+
+	expect := func(expected string) {
+		t.Helper()
+		token, err := source.AccessToken()
+		if err != nil || token != expected {
+			t.Fatalf("expected %s, got %s, error %v", expected, token, err)
+		}
+	}
+	expect("token-1")
+	if len(endpoint.requests) != 1 || endpoint.requests[0].AppId != "1024" {
+		t.Fatalf("unexpected token requests %+v", endpoint.requests)
+	}
+
+	// cached until shortly before the expiry
+	now = now.Add(7200*time.Second - RefreshBeforeExpiry - time.Second)
+	expect("token-1")
+	now = now.Add(2 * time.Second)
+	expect("token-2")
+
+	// the current token is kept while the endpoint fails and it has not expired yet
+	endpoint.setFailing(true)
+	now = now.Add(7200*time.Second - RefreshBeforeExpiry/2)
+	expect("token-2")
+	now = now.Add(RefreshBeforeExpiry)
+	if _, err := source.AccessToken(); err == nil {
+		t.Fatalf("expired token should not be used")
+	}
+	endpoint.setFailing(false)
+	expect("token-3")
+}
+
+func TestAuthorizationFallsBackToBotToken(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+	defer func() { DefaultTokenSource = nil }()
+
+	token := common.Token{AppID: 1024, AccessToken: "legacy"}
+	DefaultTokenSource = nil
+	if authorization, _ := GetAuthorization(token); authorization != "Bot 1024.legacy" {
+		t.Fatalf("bot token should be used without secret, got %s", authorization)
+	}
+
+	DefaultTokenSource = NewAppAccessTokenSource(server.URL, 1024, "secret")
+	if authorization, _ := GetAuthorization(token); authorization != "QQBot token-1" {
+		t.Fatalf("app access token should be preferred, got %s", authorization)
+	}
+
+	DefaultTokenSource = NewAppAccessTokenSource(server.URL, 1024, "wrong")
+	if authorization, _ := GetAuthorization(token); authorization != "Bot 1024.legacy" {
+		t.Fatalf("bot token should be the fallback, got %s", authorization)
+	}
+	if _, err := GetAuthorization(common.Token{AppID: 1024}); err == nil {
+		t.Fatalf("error expected without any token")
+	}
+}
+
+func TestAppAccessTokenIsFetchedOnce(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{release: make(chan bool)}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+	source := NewAppAccessTokenSource(server.URL, 1024, "secret")
+
+	// callers without a token wait for the same fetch
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if token, err := source.AccessToken(); err != nil || token != "token-1" {
+				t.Errorf("expected token-1, got %s, error %v", token, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(endpoint.release)
+	group.Wait()
+	if count := endpoint.requestCount(); count != 1 {
+		t.Fatalf("token should be fetched once, got %d requests", count)
+	}
+
+	// callers with a valid token do not wait for the refresh
+	endpoint.release = make(chan bool)
+	now := time.Now().Add(7200*time.Second - RefreshBeforeExpiry/2)
+	source.Now = func() time.Time { return now }
+	refreshed := make(chan string)
+	go func() {
+		token, _ := source.AccessToken()
+		refreshed <- token
+	}()
+	for refreshing := false; !refreshing; time.Sleep(time.Millisecond) {
+		source.lock.Lock()
+		refreshing = source.refreshing != nil
+		source.lock.Unlock()
+	}
+	if token, err := source.AccessToken(); err != nil || token != "token-1" {
+		t.Fatalf("current token should be used while refreshing, got %s, error %v", token, err)
+	}
+	close(endpoint.release)
+	if token := <-refreshed; token != "token-2" {
+		t.Fatalf("expected token-2, got %s", token)
+	}
+}
+
+func TestAppAccessTokenBacksOffFailingRefresh(t *testing.T) {
+	endpoint := &fakeTokenEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+	now := time.Now()
+	source := NewAppAccessTokenSource(server.URL, 1024, "secret")
+	source.Now = func() time.Time { return now }
+	if _, err := source.AccessToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoint.setFailing(true)
+	now = now.Add(7200*time.Second - RefreshBeforeExpiry)
+	for _, wait := range []time.Duration{0, MinRefreshBackoff, 2 * MinRefreshBackoff} {
+		now = now.Add(wait)
+		before := endpoint.requestCount()
+		for i := 0; i < 3; i++ {
+			if token, err := source.AccessToken(); err != nil || token != "token-1" {
+				t.Fatalf("current token should be kept, got %s, error %v", token, err)
+			}
+		}
+		if count := endpoint.requestCount(); count != before+1 {
+			t.Fatalf("refresh should be retried once per backoff, got %d requests after %d", count, before)
+		}
+	}
+
+	endpoint.setFailing(false)
+	now = now.Add(4 * MinRefreshBackoff)
+	if token, err := source.AccessToken(); err != nil || token != "token-2" {
+		t.Fatalf("expected token-2, got %s, error %v", token, err)
+	}
+	if source.failures != 0 {
+		t.Fatalf("failures should be reset, got %d", source.failures)
+	}
+}
+
+func TestRefreshBackoff(t *testing.T) {
+	if RefreshBackoff(1) != MinRefreshBackoff || RefreshBackoff(2) != 2*MinRefreshBackoff || RefreshBackoff(100) != MaxRefreshBackoff {
+		t.Fatalf("unexpected backoff %v %v %v", RefreshBackoff(1), RefreshBackoff(2), RefreshBackoff(100))
+	}
+}
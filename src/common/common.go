@@ -12,6 +12,8 @@ type Asset struct {
 type AssetVariant struct {
 	Name    string `json:"name"`
 	Variant int    `json:"variant"`
+	// Emoji stands for the variant in text messages
+	Emoji string `json:"emoji"`
 }
 
 type AssetMeta struct {
@@ -22,16 +24,56 @@ type AssetMeta struct {
 type Token struct {
 	AppID       uint64
 	AccessToken string
+	// Secret is the bot secret, used to sign webhook responses
+	Secret string
 }
 
+type DeliveryMode = string
+
+const (
+	// Gateway receives events through the websocket gateway
+	Gateway DeliveryMode = "gateway"
+	// Webhook receives events as HTTP callbacks
+	Webhook DeliveryMode = "webhook"
+)
+
+type Delivery struct {
+	Mode DeliveryMode
+	// Address is where the webhook server listens
+	Address string
+	// Intents and Shard are sent to the gateway when identifying
+	Intents int32
+	Shard   [2]int
+}
+
+// DisplayMode is how revealed cards are shown in a channel
+type DisplayMode = string
+
+const (
+	DisplayImage DisplayMode = "image"
+	DisplayText  DisplayMode = "text"
+	DisplayBoth  DisplayMode = "both"
+)
+
 type Rule struct {
 	ValidCardNumber  int
 	FruitNumberToWin int
 	DealInterval     time.Duration
+	WinReward        int
+	FakeRingPenalty  int
+	MinPlayers       int
+	MaxPlayers       int
+	// Display is empty in games saved before it was introduced, which show images
+	Display DisplayMode
+	// Locale of the messages of the channel, empty to follow the guild
+	Locale string
+	// Deck is the name of the deck profile, empty for the official deck
+	Deck string
 }
 
 type Card struct {
-	Image    string        `json:"image"`
+	// Image is optional, cards are drawn from their type, variant and elements
+	Image    string        `json:"image,omitempty"`
 	Type     CardType      `json:"type"`
 	Variant  int           `json:"variant"`
 	Repeat   int           `json:"repeat"`
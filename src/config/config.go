@@ -0,0 +1,392 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"halligalli/assets"
+	"halligalli/auth"
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/model"
+	"halligalli/storage"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EnvPrefix is prepended to the upper-cased flag name to get its environment variable,
+	// for example rule.interval is read from HALLIGALLI_RULE_INTERVAL
+	EnvPrefix = "HALLIGALLI_"
+	Sandbox   = "sandbox"
+	Prod      = "prod"
+)
+
+// DefaultConfigPaths are tried in order when no config file is given,
+// auth/config.yaml is where the token used to be kept
+var DefaultConfigPaths = []string{"config.yaml", "auth/config.yaml"}
+
+type RuleConfig struct {
+	Window          int           `yaml:"window"`
+	Target          int           `yaml:"target"`
+	Interval        time.Duration `yaml:"interval"`
+	WinReward       int           `yaml:"win_reward"`
+	FakeRingPenalty int           `yaml:"fake_ring_penalty"`
+	MinPlayers      int           `yaml:"min_players"`
+	MaxPlayers      int           `yaml:"max_players"`
+	Display         string        `yaml:"display"`
+	Deck            string        `yaml:"deck"`
+}
+
+// Config is read from the config file, then environment variables, then command line flags,
+// each one overriding the previous one
+type Config struct {
+	AppID       uint64     `yaml:"appid"`
+	Token       string     `yaml:"token"`
+	Secret      string     `yaml:"secret"`
+	Environment string     `yaml:"environment"`
+	ApiUrl      string     `yaml:"api_url"`
+	TokenUrl    string     `yaml:"token_url"`
+	Mode        string     `yaml:"mode"`
+	Listen      string     `yaml:"listen"`
+	Intents     Intents    `yaml:"intents"`
+	Shard       Shard      `yaml:"shard"`
+	Keyboard    bool       `yaml:"keyboard"`
+	Rule        RuleConfig `yaml:"rule"`
+	AssetPath   string     `yaml:"asset_path"`
+	Locale      string     `yaml:"locale"`
+	LocalePath  string     `yaml:"locale_path"`
+	LogLevel    string     `yaml:"log_level"`
+	StoragePath string     `yaml:"storage_path"`
+}
+
+func Default() Config {
+	rule := env.GetContext().GameRule
+	return Config{
+		Environment: Sandbox,
+		TokenUrl:    auth.AppAccessTokenUrl,
+		Mode:        common.Gateway,
+		Listen:      ":8080",
+		Intents:     Intents{"guilds", "guild_members", "guild_messages", "guild_message_reactions", "direct_message", "interaction"},
+		Shard:       Shard{0, 1},
+		Rule: RuleConfig{
+			Window:          rule.ValidCardNumber,
+			Target:          rule.FruitNumberToWin,
+			Interval:        rule.DealInterval,
+			WinReward:       rule.WinReward,
+			FakeRingPenalty: rule.FakeRingPenalty,
+			MinPlayers:      rule.MinPlayers,
+			MaxPlayers:      rule.MaxPlayers,
+			Display:         rule.Display,
+			Deck:            rule.Deck,
+		},
+		AssetPath:   assets.DefaultAssetPath,
+		Locale:      locale.Chinese,
+		LocalePath:  locale.DefaultDir,
+		LogLevel:    Info,
+		StoragePath: storage.DefaultDir,
+	}
+}
+
+// Load builds the config from the command line arguments, without the program name,
+// and the environment variables read by getenv
+func Load(args []string, getenv func(string) string) (Config, error) {
+	config := Default()
+
+	path := findConfigPath(args, getenv)
+	if path != "" {
+		if err := config.ReadFile(path); err != nil {
+			return Config{}, err
+		}
+	} else {
+		for _, candidate := range DefaultConfigPaths {
+			err := config.ReadFile(candidate)
+			if err == nil {
+				path = candidate
+				break
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return Config{}, err
+			}
+		}
+	}
+
+	flags := config.flagSet()
+	var envErrors []error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := EnvName(f.Name)
+		value := getenv(name)
+		if value == "" || f.Name == "config" {
+			return
+		}
+		if err := f.Value.Set(value); err != nil {
+			envErrors = append(envErrors, fmt.Errorf("invalid %s=%q: %w", name, value, err))
+		}
+	})
+	if len(envErrors) > 0 {
+		return Config{}, errors.Join(envErrors...)
+	}
+	if err := flags.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %v", flags.Args())
+	}
+
+	if err := config.Validate(); err != nil {
+		if path == "" {
+			path = "without config file"
+		}
+		return Config{}, fmt.Errorf("invalid config (%s):\n%w", path, err)
+	}
+	return config, nil
+}
+
+func (config *Config) ReadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err = yaml.Unmarshal(content, config); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(flagName))
+}
+
+func (config *Config) flagSet() *flag.FlagSet {
+	flags := flag.NewFlagSet("halligalli", flag.ContinueOnError)
+	flags.String("config", "", "config file, "+strings.Join(DefaultConfigPaths, " or ")+" by default")
+	flags.Uint64Var(&config.AppID, "appid", config.AppID, "app id of the bot")
+	flags.StringVar(&config.Token, "token", config.Token, "bot token, used when there is no secret or the access token is unavailable")
+	flags.StringVar(&config.Secret, "secret", config.Secret, "bot secret for app access tokens and webhook signatures")
+	flags.StringVar(&config.Environment, "env", config.Environment, "OpenAPI environment, sandbox or prod")
+	flags.StringVar(&config.ApiUrl, "api-url", config.ApiUrl, "OpenAPI base url, overrides the environment")
+	flags.StringVar(&config.TokenUrl, "token-url", config.TokenUrl, "url to get app access tokens from")
+	flags.StringVar(&config.Mode, "mode", config.Mode, "how events are received, gateway or webhook")
+	flags.StringVar(&config.Listen, "listen", config.Listen, "address of the webhook server")
+	flags.Var(&config.Intents, "intents", "comma separated intents to subscribe to")
+	flags.Var(&config.Shard, "shard", "shard of the gateway as id/count")
+	flags.BoolVar(&config.Keyboard, "keyboard", config.Keyboard, "send text messages as Markdown with game control buttons")
+	flags.IntVar(&config.Rule.Window, "rule.window", config.Rule.Window, "default number of cards checked for the bell")
+	flags.IntVar(&config.Rule.Target, "rule.target", config.Rule.Target, "default number of fruits to ring the bell")
+	flags.DurationVar(&config.Rule.Interval, "rule.interval", config.Rule.Interval, "default interval between cards")
+	flags.IntVar(&config.Rule.WinReward, "rule.win-reward", config.Rule.WinReward, "score of a correct ring")
+	flags.IntVar(&config.Rule.FakeRingPenalty, "rule.fake-ring-penalty", config.Rule.FakeRingPenalty, "score lost by a wrong ring")
+	flags.IntVar(&config.Rule.MinPlayers, "rule.min-players", config.Rule.MinPlayers, "players needed to start a game")
+	flags.IntVar(&config.Rule.MaxPlayers, "rule.max-players", config.Rule.MaxPlayers, "players allowed in a game, 0 for no limit")
+	flags.StringVar(&config.Rule.Display, "rule.display", config.Rule.Display, "how cards are shown, image, text or both")
+	flags.StringVar(&config.Rule.Deck, "rule.deck", config.Rule.Deck, "default deck, "+strings.Join(game.DeckProfileNames(), ", "))
+	flags.StringVar(&config.AssetPath, "assets", config.AssetPath, "card asset file")
+	flags.StringVar(&config.Locale, "locale", config.Locale, "locale of the channels and guilds that have not chosen one")
+	flags.StringVar(&config.LocalePath, "locales", config.LocalePath, "directory of the locale files")
+	flags.StringVar(&config.LogLevel, "log-level", config.LogLevel, "debug, info or error")
+	flags.StringVar(&config.StoragePath, "storage", config.StoragePath, "directory of the game data")
+	return flags
+}
+
+// findConfigPath looks for the config flag before the other flags are parsed
+func findConfigPath(args []string, getenv func(string) string) string {
+	for index, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+		if name == "config" && index+1 < len(args) {
+			return args[index+1]
+		}
+		if strings.HasPrefix(name, "config=") {
+			return strings.TrimPrefix(name, "config=")
+		}
+	}
+	return getenv(EnvName("config"))
+}
+
+// Validate reports every invalid value at once
+func (config *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(config.AppID != 0, "appid is required")
+	check(config.Token != "" || config.Secret != "", "either token or secret is required")
+	if config.ApiUrl == "" {
+		check(config.Environment == Sandbox || config.Environment == Prod,
+			"environment %q should be %s or %s", config.Environment, Sandbox, Prod)
+	} else {
+		check(isHttpUrl(config.ApiUrl), "api_url %q should be an http or https url", config.ApiUrl)
+	}
+	if config.Secret != "" {
+		check(isHttpUrl(config.TokenUrl), "token_url %q should be an http or https url", config.TokenUrl)
+	}
+	switch config.Mode {
+	case common.Gateway:
+	case common.Webhook:
+		check(config.Secret != "", "webhook mode requires the secret")
+		check(config.Listen != "", "webhook mode requires a listen address")
+	default:
+		check(false, "mode %q should be %s or %s", config.Mode, common.Gateway, common.Webhook)
+	}
+	check(len(config.Intents) > 0, "at least one intent is required")
+	for _, intent := range config.Intents {
+		_, ok := model.IntentFlags[intent]
+		check(ok, "unknown intent %q, expected one of %s", intent, strings.Join(knownIntents(), ", "))
+	}
+	check(config.Shard[1] > 0 && config.Shard[0] >= 0 && config.Shard[0] < config.Shard[1],
+		"shard %s should be an id between 0 and the shard count", config.Shard.String())
+
+	rule := config.Rule
+	check(rule.Window >= game.MinValidCardNumber && rule.Window <= game.MaxValidCardNumber,
+		"rule.window %d should be between %d and %d", rule.Window, game.MinValidCardNumber, game.MaxValidCardNumber)
+	check(rule.Target >= game.MinFruitNumberToWin && rule.Target <= game.MaxFruitNumberToWin,
+		"rule.target %d should be between %d and %d", rule.Target, game.MinFruitNumberToWin, game.MaxFruitNumberToWin)
+	check(rule.Interval >= game.MinDealInterval && rule.Interval <= game.MaxDealInterval,
+		"rule.interval %v should be between %v and %v", rule.Interval, game.MinDealInterval, game.MaxDealInterval)
+	check(rule.WinReward >= 0, "rule.win_reward %d should not be negative", rule.WinReward)
+	check(rule.FakeRingPenalty >= 0, "rule.fake_ring_penalty %d should not be negative", rule.FakeRingPenalty)
+	check(rule.MinPlayers >= 1, "rule.min_players %d should be at least 1", rule.MinPlayers)
+	check(rule.MaxPlayers == 0 || rule.MaxPlayers >= rule.MinPlayers,
+		"rule.max_players %d should be 0 or at least rule.min_players", rule.MaxPlayers)
+	_, knownDisplay := game.ParseDisplayMode(rule.Display)
+	check(knownDisplay, "rule.display %q should be %s, %s or %s", rule.Display, common.DisplayImage, common.DisplayText, common.DisplayBoth)
+	_, knownDeck := game.FindDeckProfile(rule.Deck)
+	check(knownDeck, "unknown rule.deck %q, expected one of %s", rule.Deck, strings.Join(game.DeckProfileNames(), ", "))
+
+	check(config.AssetPath != "", "asset_path is required")
+	check(config.Locale != "", "locale is required")
+	check(config.LocalePath != "", "locale_path is required")
+	check(config.StoragePath != "", "storage_path is required")
+	_, ok := logLevels[config.LogLevel]
+	check(ok, "log_level %q should be %s, %s or %s", config.LogLevel, Debug, Info, Error)
+	return errors.Join(errs...)
+}
+
+func (config *Config) BaseUrl() string {
+	if config.ApiUrl != "" {
+		return strings.TrimRight(config.ApiUrl, "/")
+	}
+	if config.Environment == Prod {
+		return env.Prod
+	}
+	return env.Test
+}
+
+// Apply makes the config effective for the whole bot
+func (config *Config) Apply() {
+	env.Env = config.BaseUrl()
+	context := env.GetContext()
+	context.Token = common.Token{
+		AppID:       config.AppID,
+		AccessToken: config.Token,
+		Secret:      config.Secret,
+	}
+	context.Delivery = common.Delivery{
+		Mode:    config.Mode,
+		Address: config.Listen,
+		Intents: config.Intents.Flags(),
+		Shard:   config.Shard,
+	}
+	context.Keyboard = config.Keyboard
+	context.Locale = config.Locale
+	context.GameRule = common.Rule{
+		ValidCardNumber:  config.Rule.Window,
+		FruitNumberToWin: config.Rule.Target,
+		DealInterval:     config.Rule.Interval,
+		WinReward:        config.Rule.WinReward,
+		FakeRingPenalty:  config.Rule.FakeRingPenalty,
+		MinPlayers:       config.Rule.MinPlayers,
+		MaxPlayers:       config.Rule.MaxPlayers,
+		Display:          config.Rule.Display,
+		Deck:             config.Rule.Deck,
+	}
+	auth.DefaultTokenSource = nil
+	if config.Secret != "" {
+		auth.DefaultTokenSource = auth.NewAppAccessTokenSource(config.TokenUrl, config.AppID, config.Secret)
+	}
+	slog.SetDefault(NewLogger(os.Stderr, config.LogLevel))
+}
+
+func isHttpUrl(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func knownIntents() []string {
+	names := make([]string, 0, len(model.IntentFlags))
+	for name := range model.IntentFlags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Intents are the names of model.IntentFlags
+type Intents []string
+
+func (intents *Intents) String() string {
+	if intents == nil {
+		return ""
+	}
+	return strings.Join(*intents, ",")
+}
+
+func (intents *Intents) Set(value string) error {
+	*intents = make(Intents, 0)
+	for _, intent := range strings.Split(value, ",") {
+		if intent = strings.TrimSpace(intent); intent != "" {
+			*intents = append(*intents, strings.ToLower(intent))
+		}
+	}
+	return nil
+}
+
+func (intents Intents) Flags() int32 {
+	var flags int32
+	for _, intent := range intents {
+		flags |= model.IntentFlags[intent]
+	}
+	return flags
+}
+
+// Shard is the shard id followed by the shard count
+type Shard [2]int
+
+func (shard *Shard) String() string {
+	if shard == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", shard[0], shard[1])
+}
+
+func (shard *Shard) Set(value string) error {
+	id, count, ok := strings.Cut(value, "/")
+	if !ok {
+		return fmt.Errorf("shard %q should be written as id/count", value)
+	}
+	var err error
+	if shard[0], err = strconv.Atoi(strings.TrimSpace(id)); err != nil {
+		return err
+	}
+	if shard[1], err = strconv.Atoi(strings.TrimSpace(count)); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func mapEnv(values map[string]string) func(string) string {
+	return func(name string) string {
+		return values[name]
+	}
+}
+
+func TestLoadOverridesFileWithEnvAndFlags(t *testing.T) {
+	path := writeConfig(t, `
+appid: 1024
+token: file-token
+environment: prod
+intents: [guilds, public_guild_messages]
+shard: [1, 4]
+rule:
+  window: 4
+  interval: 10s
+log_level: error
+`)
+	config, err := Load([]string{"-config", path, "-rule.window", "6", "--storage=/tmp/data"}, mapEnv(map[string]string{
+		"HALLIGALLI_TOKEN":       "env-token",
+		"HALLIGALLI_RULE_WINDOW": "3",
+		"HALLIGALLI_RULE_TARGET": "7",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.AppID != 1024 || config.Token != "env-token" || config.StoragePath != "/tmp/data" {
+		t.Fatalf("unexpected credentials or paths %+v", config)
+	}
+	if config.Rule.Window != 6 || config.Rule.Target != 7 || config.Rule.Interval != 10*time.Second {
+		t.Fatalf("unexpected rule %+v", config.Rule)
+	}
+	if config.BaseUrl() != env.Prod || config.Shard != (Shard{1, 4}) || config.Intents.Flags() != 1+(1<<30) {
+		t.Fatalf("unexpected gateway settings %+v", config)
+	}
+	// defaults are kept for values that are not given
+	if config.Mode != common.Gateway || config.Rule.WinReward != env.GetContext().GameRule.WinReward || config.LogLevel != Error {
+		t.Fatalf("unexpected defaults %+v", config)
+	}
+}
+
+func TestLoadFromEnvWithoutFile(t *testing.T) {
+	config, err := Load([]string{"-config", writeConfig(t, "")}, mapEnv(map[string]string{
+		"HALLIGALLI_APPID":   "42",
+		"HALLIGALLI_SECRET":  "secret",
+		"HALLIGALLI_API_URL": "http://localhost:8000/",
+		"HALLIGALLI_MODE":    "webhook",
+		"HALLIGALLI_SHARD":   "0/2",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.BaseUrl() != "http://localhost:8000" || config.Mode != common.Webhook || config.Shard != (Shard{0, 2}) {
+		t.Fatalf("unexpected config %+v", config)
+	}
+}
+
+func TestLoadReportsEveryInvalidValue(t *testing.T) {
+	path := writeConfig(t, `
+appid: 1
+token: token
+environment: staging
+mode: webhook
+intents: [guilds, typo]
+shard: [2, 2]
+rule:
+  window: 20
+  interval: 1s
+  display: video
+log_level: verbose
+`)
+	_, err := Load([]string{"-config", path}, mapEnv(nil))
+	if err == nil {
+		t.Fatalf("invalid config should not load")
+	}
+	for _, expected := range []string{"environment", "webhook mode requires the secret", `unknown intent "typo"`,
+		"shard 2/2", "rule.window 20", "rule.interval 1s",
+		`rule.display "video"`, "log_level"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("error should mention %q, got:\n%v", expected, err)
+		}
+	}
+
+	if _, err = Load([]string{"-config", path + ".missing"}, mapEnv(nil)); err == nil {
+		t.Fatalf("missing config file given explicitly should fail")
+	}
+	if _, err = Load([]string{"-config", writeConfig(t, "appid: 1\ntoken: t\n")}, mapEnv(map[string]string{
+		"HALLIGALLI_RULE_INTERVAL": "soon",
+	})); err == nil || !strings.Contains(err.Error(), "HALLIGALLI_RULE_INTERVAL") {
+		t.Fatalf("invalid environment variable should be reported, got %v", err)
+	}
+}
+
+func TestLoggerFiltersLevels(t *testing.T) {
+	records := []string{"level=DEBUG msg=receive", "level=INFO msg=\"game started\"", "level=ERROR msg=\"sending message\""}
+	tests := []struct {
+		level string
+		shown int
+	}{
+		{level: Debug, shown: 3},
+		{level: Info, shown: 2},
+		{level: Error, shown: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.level, func(t *testing.T) {
+			var builder strings.Builder
+			logger := NewLogger(&builder, test.level)
+			logger.Debug("receive", "body", "{}")
+			// the level is explicit, a record mentioning an error is still info
+			logger.Info("game started", "last", "ERROR")
+			logger.Error("sending message", "err", "timeout")
+			for index, record := range records {
+				shown := strings.Contains(builder.String(), record)
+				if shown != (index >= len(records)-test.shown) {
+					t.Fatalf("record %q shown: %t, got %q", record, shown, builder.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"io"
+	"log/slog"
+)
+
+const (
+	Debug = "debug"
+	Info  = "info"
+	Error = "error"
+)
+
+var logLevels = map[string]slog.Level{
+	Debug: slog.LevelDebug,
+	Info:  slog.LevelInfo,
+	Error: slog.LevelError,
+}
+
+// NewLogger drops the records below the level, raw traffic is logged at the debug level
+// and lines of the log package at the info level
+func NewLogger(out io.Writer, level string) *slog.Logger {
+	return slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: logLevels[level]}))
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/gorilla/websocket"
 	"halligalli/common"
 	"halligalli/model"
+	"halligalli/storage"
 	"sync"
 	"time"
 )
@@ -12,21 +13,39 @@ import (
 var lock = &sync.Mutex{}
 
 type Context struct {
-	User           model.User
-	Token          common.Token
-	Asset          common.Asset
-	GameRule       common.Rule
-	ReplyMessageId string
-	Connection     *websocket.Conn
+	User     model.User
+	Token    common.Token
+	Delivery common.Delivery
+	// Keyboard sends the text messages of the bot as Markdown with game control buttons
+	Keyboard bool
+	// Locale is used by the channels and guilds that have not chosen one
+	Locale     string
+	Asset      common.Asset
+	GameRule   common.Rule
+	Connection *websocket.Conn
+	Store      storage.Store
 }
 
 var instance *Context
 
 func OnInit(context *Context) {
+	context.Locale = "zh"
+	context.Delivery = common.Delivery{
+		Mode:    common.Gateway,
+		Address: ":8080",
+		Intents: model.Intents,
+		Shard:   [2]int{0, 1},
+	}
 	context.GameRule = common.Rule{
 		ValidCardNumber:  5,
 		FruitNumberToWin: 5,
 		DealInterval:     7 * time.Second,
+		WinReward:        10,
+		FakeRingPenalty:  5,
+		MinPlayers:       1,
+		MaxPlayers:       0,
+		Display:          common.DisplayImage,
+		Deck:             "official",
 	}
 }
 
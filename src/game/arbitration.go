@@ -0,0 +1,97 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"sort"
+	"time"
+)
+
+// ArbitrationWindow is how long competing rings are collected after the first one arrives
+const ArbitrationWindow = 1500 * time.Millisecond
+
+type Ring struct {
+	Player model.User
+	// Timestamp is the server time of the message that rang the bell, precise to the second, zero for reactions
+	Timestamp time.Time
+	// Seq is the sequence of the message in its channel, it breaks ties between messages sent within the same second
+	Seq int
+	// ReceivedAt is the local time the ring was received, on the same clock as reveals, reactions are measured with it
+	ReceivedAt time.Time
+	// Card is the card reacted to, nil for rings sent as messages
+	Card *RevealedCard
+}
+
+// SentAt is the second the ring was sent in, reactions have no server timestamp and count as sent when they were received
+func (ring Ring) SentAt() time.Time {
+	if ring.Timestamp.IsZero() {
+		return ring.ReceivedAt.Truncate(time.Second)
+	}
+	return ring.Timestamp
+}
+
+// RevealedCard links a card message to the round it was revealed in
+type RevealedCard struct {
+	Card  common.Card
+	Round int
+	// Window is the cards checked for the bell once this card is revealed
+	Window []common.Card `json:"-"`
+	// Display is how the channel shows the card
+	Display common.DisplayMode `json:"-"`
+}
+
+func (game *Game) NewRevealedCard(card common.Card) RevealedCard {
+	return RevealedCard{
+		Card:    card,
+		Round:   game.Round,
+		Window:  game.GetValidCards(),
+		Display: game.Rule.Display,
+	}
+}
+
+type RunnerUp struct {
+	Player model.User
+	// Gap is measured between the receive times, zero if the ring was received before the winning one
+	Gap time.Duration
+}
+
+// AddRing collects a ring during arbitration, only the first ring of each player counts
+func (game *Game) AddRing(ring Ring) bool {
+	for _, current := range game.Rings {
+		if current.Player.Id == ring.Player.Id {
+			return false
+		}
+	}
+	game.Rings = append(game.Rings, ring)
+	return true
+}
+
+// Arbitrate orders the collected rings by server timestamp, then by sequence in channel.
+// Reactions count as sent in the second they were received, after the messages of that second,
+// and are ordered among themselves by receive time
+func (game *Game) Arbitrate() (Ring, []RunnerUp) {
+	rings := make([]Ring, len(game.Rings))
+	copy(rings, game.Rings)
+	sort.SliceStable(rings, func(i, j int) bool {
+		if !rings[i].SentAt().Equal(rings[j].SentAt()) {
+			return rings[i].SentAt().Before(rings[j].SentAt())
+		}
+		iReaction, jReaction := rings[i].Timestamp.IsZero(), rings[j].Timestamp.IsZero()
+		if iReaction != jReaction {
+			return jReaction
+		}
+		if iReaction {
+			return rings[i].ReceivedAt.Before(rings[j].ReceivedAt)
+		}
+		return rings[i].Seq < rings[j].Seq
+	})
+	runnersUp := make([]RunnerUp, 0, len(rings)-1)
+	for _, ring := range rings[1:] {
+		runnersUp = append(runnersUp, RunnerUp{
+			Player: ring.Player,
+			Gap:    max(ring.ReceivedAt.Sub(rings[0].ReceivedAt), 0),
+		})
+	}
+	game.Rings = nil
+	return rings[0], runnersUp
+}
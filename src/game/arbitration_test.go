@@ -0,0 +1,127 @@
+package game
+
+import (
+	"halligalli/model"
+	"testing"
+	"time"
+)
+
+func TestArbitrateOrdersRings(t *testing.T) {
+	// server timestamps are whole seconds
+	start := time.Now().Truncate(time.Second)
+	alice := model.User{Id: "alice"}
+	bob := model.User{Id: "bob"}
+	carol := model.User{Id: "carol"}
+	dave := model.User{Id: "dave"}
+
+	tests := []struct {
+		name      string
+		rings     []Ring
+		first     string
+		runnersUp []RunnerUp
+	}{
+		{
+			name:  "single ring",
+			rings: []Ring{{Player: alice, Timestamp: start, ReceivedAt: start}},
+			first: "alice",
+		},
+		{
+			name: "earliest server timestamp wins over arrival order",
+			rings: []Ring{
+				{Player: alice, Timestamp: start.Add(2 * time.Second), Seq: 1, ReceivedAt: start.Add(100 * time.Millisecond)},
+				{Player: bob, Timestamp: start, Seq: 2, ReceivedAt: start.Add(300 * time.Millisecond)},
+				{Player: carol, Timestamp: start.Add(time.Second), Seq: 3, ReceivedAt: start.Add(450 * time.Millisecond)},
+			},
+			first: "bob",
+			runnersUp: []RunnerUp{
+				{Player: carol, Gap: 150 * time.Millisecond},
+				{Player: alice},
+			},
+		},
+		{
+			name: "sequence in channel breaks ties within a second",
+			rings: []Ring{
+				{Player: alice, Timestamp: start, Seq: 7, ReceivedAt: start},
+				{Player: bob, Timestamp: start, Seq: 5, ReceivedAt: start.Add(200 * time.Millisecond)},
+				{Player: carol, Timestamp: start, Seq: 6, ReceivedAt: start.Add(100 * time.Millisecond)},
+			},
+			first: "bob",
+			runnersUp: []RunnerUp{
+				{Player: carol},
+				{Player: alice},
+			},
+		},
+		{
+			name: "ties without sequence keep arrival order",
+			rings: []Ring{
+				{Player: dave, Timestamp: start, ReceivedAt: start},
+				{Player: alice, Timestamp: start, ReceivedAt: start.Add(time.Millisecond)},
+			},
+			first:     "dave",
+			runnersUp: []RunnerUp{{Player: alice, Gap: time.Millisecond}},
+		},
+		{
+			name: "reactions come after the messages of their second",
+			rings: []Ring{
+				{Player: alice, ReceivedAt: start.Add(100 * time.Millisecond)},
+				{Player: bob, Timestamp: start, Seq: 9, ReceivedAt: start.Add(300 * time.Millisecond)},
+				{Player: carol, ReceivedAt: start.Add(50 * time.Millisecond)},
+			},
+			first: "bob",
+			runnersUp: []RunnerUp{
+				{Player: carol},
+				{Player: alice},
+			},
+		},
+		{
+			name: "reaction of an earlier second wins",
+			rings: []Ring{
+				{Player: alice, Timestamp: start.Add(time.Second), Seq: 1, ReceivedAt: start.Add(time.Second)},
+				{Player: bob, ReceivedAt: start.Add(900 * time.Millisecond)},
+			},
+			first:     "bob",
+			runnersUp: []RunnerUp{{Player: alice, Gap: 100 * time.Millisecond}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := &Game{}
+			for _, ring := range test.rings {
+				game.AddRing(ring)
+			}
+			first, runnersUp := game.Arbitrate()
+			if first.Player.Id != test.first {
+				t.Fatalf("first ring should be from %s, got %+v", test.first, first)
+			}
+			if len(runnersUp) != len(test.runnersUp) {
+				t.Fatalf("expected runners up %+v, got %+v", test.runnersUp, runnersUp)
+			}
+			for index, expected := range test.runnersUp {
+				if runnersUp[index] != expected {
+					t.Fatalf("expected runners up %+v, got %+v", test.runnersUp, runnersUp)
+				}
+			}
+			if len(game.Rings) != 0 {
+				t.Fatalf("rings should be cleared after arbitration, got %+v", game.Rings)
+			}
+		})
+	}
+}
+
+func TestAddRingKeepsFirstRingOfPlayer(t *testing.T) {
+	start := time.Now().Truncate(time.Second)
+	game := &Game{}
+	if !game.AddRing(Ring{Player: model.User{Id: "alice"}, Timestamp: start.Add(time.Second), ReceivedAt: start.Add(time.Second)}) {
+		t.Fatalf("first ring of a player should be collected")
+	}
+	if game.AddRing(Ring{Player: model.User{Id: "alice"}, Timestamp: start, ReceivedAt: start}) {
+		t.Fatalf("second ring of a player should be ignored")
+	}
+	game.AddRing(Ring{Player: model.User{Id: "bob"}, Timestamp: start, Seq: 1, ReceivedAt: start.Add(500 * time.Millisecond)})
+
+	first, runnersUp := game.Arbitrate()
+	if first.Player.Id != "bob" || len(runnersUp) != 1 || runnersUp[0].Player.Id != "alice" ||
+		runnersUp[0].Gap != 500*time.Millisecond {
+		t.Fatalf("earlier duplicate should not count, got %+v %+v", first, runnersUp)
+	}
+}
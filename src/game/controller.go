@@ -1,17 +1,28 @@
 package game
 
 import (
-	"halligalli/env"
+	"errors"
+	"halligalli/assets"
+	"halligalli/common"
 	"halligalli/model"
-	"log"
+	"halligalli/storage"
+	"log/slog"
+	"time"
 )
 
 type EventType = int
 
+// ReplyContext identifies the message a reply is sent for
+type ReplyContext struct {
+	MessageId string
+	GuildId   string
+	ChannelId string
+}
+
 type Event struct {
 	EventType EventType
-	ChannelId string
-	Param     any
+	ReplyContext
+	Param any
 }
 
 const (
@@ -20,6 +31,12 @@ const (
 	RingTheBell
 	Continue
 	Terminate
+	Score
+	Join
+	Leave
+	Configure
+	Stats
+	DeckInfo
 
 	Debug
 )
@@ -28,8 +45,12 @@ type MessageType = int
 
 type Message struct {
 	MessageType MessageType
-	ChannelId   string
-	Param       any
+	ReplyContext
+	Param any
+	// Rule, Mode and Players are the state of the game when the message was sent, for the templates
+	Rule    common.Rule
+	Mode    Mode
+	Players []model.User
 }
 
 const (
@@ -39,6 +60,18 @@ const (
 	FakeRing
 	Terminated
 	ExplainWhy
+	ShowScore
+	NotEnoughPlayers
+	ShowHands
+	PlayerEliminated
+	GameOver
+	ShowRoster
+	AlreadyJoined
+	LobbyFull
+	ShowRule
+	InvalidRule
+	ShowStats
+	ShowDeck
 )
 
 type RoundStatus struct {
@@ -46,123 +79,280 @@ type RoundStatus struct {
 	Player     model.User
 	AnimalName string
 	FruitName  string
+	// Animal and Fruit are the variants that won the round, 0 if none
+	Animal      int
+	Fruit       int
+	Score       int
+	ScoreChange int
+	RunnersUp   []RunnerUp
+	// Reaction is negative when it cannot be measured
+	Reaction time.Duration
 }
 
-type RevealTickerEvent struct {
-	Game *Game
+// NewMessage builds a message replying to the latest event of the game
+func (game *Game) NewMessage(messageType MessageType, param any) Message {
+	return Message{
+		MessageType:  messageType,
+		ReplyContext: game.Reply,
+		Param:        param,
+		Rule:         game.Rule,
+		Mode:         game.Mode,
+		Players:      append([]model.User(nil), game.Roster...),
+	}
 }
 
-func Initiated(game *Game, messageChannel chan Message) {
-	messageChannel <- Message{
-		MessageType: ShowGameRule,
-		Param:       nil,
-	}
+func Initiated(game *Game, mode Mode, messageChannel chan Message) {
+	game.ResetScores()
+	game.Mode = mode
+	game.Roster = make([]model.User, 0)
+	game.Rings = nil
+	messageChannel <- game.NewMessage(ShowGameRule, mode)
 	game.State = WaitingForStart
 }
 
-func RevealCardAndSend(game *Game, messageChannel chan Message) {
+// StartGame returns false if not enough players have joined the lobby
+func StartGame(game *Game, messageChannel chan Message) bool {
+	if len(game.Roster) < game.GetMinPlayers() {
+		messageChannel <- game.NewMessage(NotEnoughPlayers, game.GetRosterStatus())
+		return false
+	}
+	messageChannel <- game.NewMessage(ShowRoster, game.GetRosterStatus())
+	if game.Mode == Tabletop {
+		game.DealHands(game.Roster)
+		SendHandStatus(game, messageChannel)
+	}
+	game.NewRound()
+	game.State = Running
+	game.Record = storage.GameRecord{
+		ChannelId: game.ChannelId,
+		Mode:      game.Mode,
+		StartedAt: time.Now(),
+	}
+	return true
+}
+
+func JoinLobby(game *Game, player model.User, messageChannel chan Message) {
+	switch game.Join(player) {
+	case nil:
+		messageChannel <- game.NewMessage(ShowRoster, game.GetRosterStatus())
+	case ErrAlreadyJoined:
+		messageChannel <- game.NewMessage(AlreadyJoined, player)
+	case ErrLobbyFull:
+		messageChannel <- game.NewMessage(LobbyFull, game.GetRosterStatus())
+	}
+}
+
+func LeaveLobby(game *Game, player model.User, messageChannel chan Message) {
+	if game.Leave(player) == nil {
+		messageChannel <- game.NewMessage(ShowRoster, game.GetRosterStatus())
+	}
+}
+
+// RevealCardAndSend returns false if no card can be revealed and the game is over
+func RevealCardAndSend(game *Game, messageChannel chan Message) bool {
+	if game.Mode == Tabletop {
+		card, ok, eliminated := game.RevealFromHand()
+		for _, player := range eliminated {
+			messageChannel <- game.NewMessage(PlayerEliminated, player)
+		}
+		if !ok {
+			FinishGame(game, messageChannel)
+			return false
+		}
+		slog.Debug("card revealed", "card", card)
+		messageChannel <- game.NewMessage(CardRevealed, game.NewRevealedCard(card))
+		return true
+	}
+
 	card := game.RevealNextCard()
-	log.Printf("card revealed: %+v", card)
-	messageChannel <- Message{
-		MessageType: CardRevealed,
-		Param:       card,
+	slog.Debug("card revealed", "card", card)
+	messageChannel <- game.NewMessage(CardRevealed, game.NewRevealedCard(card))
+	return true
+}
+
+func SendHandStatus(game *Game, messageChannel chan Message) {
+	messageChannel <- game.NewMessage(ShowHands, game.GetHandStatus())
+}
+
+// FinishGame announces the last player standing of a tabletop game
+func FinishGame(game *Game, messageChannel chan Message) {
+	game.State = Closed
+	FinishRecord(game)
+	winner, _ := game.GetWinner()
+	messageChannel <- game.NewMessage(GameOver, winner)
+}
+
+// ResolveRings awards the round to the earliest ring collected during arbitration
+func ResolveRings(game *Game, messageChannel chan Message) {
+	game.State = Paused
+	rings := game.Rings
+	first, runnersUp := game.Arbitrate()
+	isWin, animal, fruit := game.WinCheck()
+	roundStatus := RoundStatus{
+		IsWin:      isWin,
+		Player:     first.Player,
+		AnimalName: assets.GetAnimalNameByVariant(animal),
+		FruitName:  assets.GetFruitNameByVariant(fruit),
+		Animal:     animal,
+		Fruit:      fruit,
+		RunnersUp:  runnersUp,
+	}
+	RecordRound(game, rings, roundStatus)
+	if isWin {
+		for _, ring := range rings {
+			reaction := game.RecordReaction(ring)
+			if ring.Player.Id == first.Player.Id {
+				roundStatus.Reaction = reaction
+			}
+		}
+		roundStatus.Score = game.AddWin(roundStatus.Player).Score
+		roundStatus.ScoreChange = game.Rule.WinReward
+		UpdateProfile(roundStatus.Player, func(profile *storage.PlayerProfile) {
+			profile.Wins += 1
+			profile.Score += roundStatus.ScoreChange
+		})
+		messageChannel <- game.NewMessage(PlayerWin, roundStatus)
+		if game.Mode == Tabletop {
+			game.CollectTable(roundStatus.Player)
+			SendHandStatus(game, messageChannel)
+		}
+		game.NewRound()
+		return
+	}
+
+	roundStatus.Score = game.AddFakeRing(roundStatus.Player).Score
+	roundStatus.ScoreChange = -game.Rule.FakeRingPenalty
+	UpdateProfile(roundStatus.Player, func(profile *storage.PlayerProfile) {
+		profile.FakeRings += 1
+		profile.Score += roundStatus.ScoreChange
+	})
+	messageChannel <- game.NewMessage(FakeRing, roundStatus)
+	if game.Mode == Tabletop {
+		if game.PayPenalty(roundStatus.Player) {
+			messageChannel <- game.NewMessage(PlayerEliminated, roundStatus.Player)
+		}
+		if _, over := game.GetWinner(); over {
+			FinishGame(game, messageChannel)
+			return
+		}
+		SendHandStatus(game, messageChannel)
 	}
 }
 
+func ConfigureRule(game *Game, config RuleConfig, messageChannel chan Message) {
+	if config.Key != "" {
+		err := game.CheckRuleLocked(config.Key, config.Value)
+		if err == nil {
+			err = game.SetRule(config.Key, config.Value)
+		}
+		if err != nil {
+			ruleError := &RuleError{Reason: InvalidRuleValue, Key: config.Key, Value: config.Value}
+			errors.As(err, &ruleError)
+			messageChannel <- game.NewMessage(InvalidRule, *ruleError)
+			return
+		}
+	}
+	messageChannel <- game.NewMessage(ShowRule, game.Rule)
+}
+
 func TerminateGame(game *Game, messageChannel chan Message) {
 	game.State = Closed
-	messageChannel <- Message{
-		MessageType: Terminated,
-		Param:       nil,
-	}
+	FinishRecord(game)
+	messageChannel <- game.NewMessage(Terminated, nil)
+}
+
+// TimerScheduler arranges the next deal or arbitration of a game
+type TimerScheduler interface {
+	Schedule(channelId string, kind TimerKind, at time.Time)
+	Cancel(channelId string)
 }
 
-func MainLoop(eventChannel chan Event, messageChannel chan Message) {
-	gameInstances := make(map[string]*Game)
-	tickerChannel := make(chan RevealTickerEvent, 32)
-	for {
-		select {
-		case event := <-eventChannel:
-			game := gameInstances[event.ChannelId]
-			if game == nil {
-				game = &Game{}
-				game.Init(event.ChannelId)
-				gameInstances[event.ChannelId] = game
+// HandleEvent applies a user event to the game
+func HandleEvent(game *Game, event Event, scheduler TimerScheduler, messageChannel chan Message) {
+	// reactions carry no message to reply to, the last message is replied to instead
+	if event.MessageId != "" {
+		game.Reply = event.ReplyContext
+	}
+	switch event.EventType {
+	case Initiate:
+		if game.State == Closed || game.State == WaitingForStart {
+			mode, _ := event.Param.(Mode)
+			Initiated(game, mode, messageChannel)
+		}
+	case Start:
+		if game.State == WaitingForStart {
+			if StartGame(game, messageChannel) && RevealCardAndSend(game, messageChannel) {
+				scheduler.Schedule(game.ChannelId, DealTimer, time.Now().Add(game.Rule.DealInterval))
 			}
-			switch event.EventType {
-			case Initiate:
-				if game.State == Closed || game.State == WaitingForStart {
-					Initiated(game, messageChannel)
-				}
-			case Start:
-				if game.State == WaitingForStart {
-					game.State = Running
-					RevealCardAndSend(game, messageChannel)
-					go WaitForNextCard(game, tickerChannel)
-				}
-			case RingTheBell:
-				if game.State == Running {
-					game.RevealTimer.Stop()
-					game.State = Paused
-					isWin, animalName, fruitName := game.WinCheck()
-					roundStatus := RoundStatus{
-						IsWin:      isWin,
-						Player:     event.Param.(model.User),
-						AnimalName: animalName,
-						FruitName:  fruitName,
-					}
-					if isWin {
-						messageChannel <- Message{
-							MessageType: PlayerWin,
-							Param:       roundStatus,
-						}
-						game.NewRound()
-					} else {
-						messageChannel <- Message{
-							MessageType: FakeRing,
-							Param:       roundStatus,
-						}
-					}
-				}
-			case Continue:
-				if game.State == Paused {
-					game.State = Running
-					RevealCardAndSend(game, messageChannel)
-					go WaitForNextCard(game, tickerChannel)
-				}
-			case Terminate:
-				if game.State == WaitingForStart || game.State == Running || game.State == Paused {
-					game.RevealTimer.Stop()
-					TerminateGame(game, messageChannel)
-				}
-			case Debug:
-				if game.State == Paused {
-					messageChannel <- Message{
-						MessageType: ExplainWhy,
-						ChannelId:   game.ChannelId,
-						Param:       game.GetValidCards(),
-					}
-				}
+		}
+	case RingTheBell:
+		ring := event.Param.(Ring)
+		if game.State != Running && game.State != Arbitrating {
+			return
+		}
+		if !game.CanRing(ring.Player) {
+			slog.Info("ignored ring from spectator", "player", ring.Player.Id)
+			return
+		}
+		if ring.Card != nil && ring.Card.Round != game.Round {
+			slog.Info("ignored ring on a card of an earlier round", "player", ring.Player.Id, "round", ring.Card.Round)
+			return
+		}
+		if game.State == Running {
+			// wait for competing rings before deciding who was the first
+			game.State = Arbitrating
+			scheduler.Schedule(game.ChannelId, ArbitrationTimer, time.Now().Add(ArbitrationWindow))
+		}
+		game.AddRing(ring)
+	case Continue:
+		if game.State == Paused {
+			game.State = Running
+			if RevealCardAndSend(game, messageChannel) {
+				scheduler.Schedule(game.ChannelId, DealTimer, time.Now().Add(game.Rule.DealInterval))
 			}
-		case tickerEvent := <-tickerChannel:
-			game := tickerEvent.Game
-			RevealCardAndSend(game, messageChannel)
-			go WaitForNextCard(game, tickerChannel)
 		}
+	case Terminate:
+		if game.State == WaitingForStart || game.State == Running || game.State == Arbitrating ||
+			game.State == Paused {
+			scheduler.Cancel(game.ChannelId)
+			TerminateGame(game, messageChannel)
+		}
+	case Debug:
+		if game.State == Paused {
+			messageChannel <- game.NewMessage(ExplainWhy, game.GetValidCards())
+		}
+	case Join:
+		if game.State == WaitingForStart {
+			JoinLobby(game, event.Param.(model.User), messageChannel)
+		}
+	case Leave:
+		if game.State == WaitingForStart {
+			LeaveLobby(game, event.Param.(model.User), messageChannel)
+		}
+	case Score:
+		messageChannel <- game.NewMessage(ShowScore, game.GetStandings())
+	case Stats:
+		messageChannel <- game.NewMessage(ShowStats, game.GetStats())
+	case Configure:
+		ConfigureRule(game, event.Param.(RuleConfig), messageChannel)
+	case DeckInfo:
+		profile, _ := FindDeckProfile(game.Rule.Deck)
+		messageChannel <- game.NewMessage(ShowDeck, CheckDeck(profile.Name, game.Deck, game.Rule))
 	}
+	SaveSnapshot(game)
 }
 
-func WaitForNextCard(game *Game, tickerChannel chan RevealTickerEvent) {
-	game.RevealTimer.Reset(env.GetContext().GameRule.DealInterval)
-	for {
-		select {
-		case <-game.RevealTimer.C:
-			if game.State == Running {
-				tickerChannel <- RevealTickerEvent{
-					Game: game,
-				}
-			}
-			break
+// HandleTimer reveals the next card or resolves the rings when their time is due
+func HandleTimer(game *Game, timer Timer, scheduler TimerScheduler, messageChannel chan Message) {
+	switch timer.Kind {
+	case DealTimer:
+		if game.State == Running && RevealCardAndSend(game, messageChannel) {
+			scheduler.Schedule(game.ChannelId, DealTimer, time.Now().Add(game.Rule.DealInterval))
+		}
+	case ArbitrationTimer:
+		if game.State == Arbitrating {
+			ResolveRings(game, messageChannel)
+			SaveSnapshot(game)
 		}
 	}
 }
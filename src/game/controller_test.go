@@ -0,0 +1,65 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"testing"
+	"time"
+)
+
+type noScheduler struct{}
+
+func (noScheduler) Schedule(string, TimerKind, time.Time) {}
+
+func (noScheduler) Cancel(string) {}
+
+func TestRingOnCardOfEarlierRoundIsIgnored(t *testing.T) {
+	player := model.User{Id: "player"}
+	game := &Game{ChannelId: "channel", State: Running, Roster: []model.User{player}, Round: 2}
+	messageChannel := make(chan Message, 8)
+	stale := &RevealedCard{Card: common.Card{Type: common.Fruit}, Round: 1}
+
+	HandleEvent(game, Event{EventType: RingTheBell, Param: Ring{Player: player, Card: stale}}, noScheduler{}, messageChannel)
+	if game.State != Running || len(game.Rings) != 0 {
+		t.Fatalf("ring on an earlier round should be ignored, state %d, rings %+v", game.State, game.Rings)
+	}
+
+	current := &RevealedCard{Card: common.Card{Type: common.Fruit}, Round: 2}
+	HandleEvent(game, Event{EventType: RingTheBell, Param: Ring{Player: player, Card: current}}, noScheduler{}, messageChannel)
+	if game.State != Arbitrating || len(game.Rings) != 1 {
+		t.Fatalf("ring on the current round should be collected, state %d, rings %+v", game.State, game.Rings)
+	}
+}
+
+func TestConfigureRuleReportsWhy(t *testing.T) {
+	game := &Game{ChannelId: "channel", State: Running}
+	messageChannel := make(chan Message, 8)
+
+	ConfigureRule(game, RuleConfig{Key: "window", Value: "4"}, messageChannel)
+	message := <-messageChannel
+	if ruleError, ok := message.Param.(RuleError); message.MessageType != InvalidRule || !ok || ruleError.Reason != RuleLocked {
+		t.Fatalf("rule should be locked while running, got %+v", message)
+	}
+	// the display and locale only change how the next messages look
+	ConfigureRule(game, RuleConfig{Key: "语言", Value: "en"}, messageChannel)
+	if message = <-messageChannel; message.MessageType != ShowRule || game.Rule.Locale != "en" || message.Rule.Locale != "en" {
+		t.Fatalf("locale should be set while running, got %+v", message)
+	}
+	ConfigureRule(game, RuleConfig{Key: "display", Value: "text"}, messageChannel)
+	if message = <-messageChannel; message.MessageType != ShowRule || game.Rule.Display != common.DisplayText {
+		t.Fatalf("display should be set while running, got %+v", message)
+	}
+
+	game.State = Paused
+	ConfigureRule(game, RuleConfig{Key: "window", Value: "20"}, messageChannel)
+	message = <-messageChannel
+	if ruleError, ok := message.Param.(RuleError); !ok || ruleError.Reason != RuleOutOfRange || ruleError.Key != "window" ||
+		ruleError.Max != MaxValidCardNumber {
+		t.Fatalf("window should be out of range, got %+v", message)
+	}
+	ConfigureRule(game, RuleConfig{Key: "locale", Value: "fr"}, messageChannel)
+	message = <-messageChannel
+	if ruleError, ok := message.Param.(RuleError); !ok || ruleError.Reason != InvalidRuleValue || ruleError.Key != "locale" {
+		t.Fatalf("unknown locale should be invalid, got %+v", message)
+	}
+}
@@ -0,0 +1,205 @@
+package game
+
+import (
+	"fmt"
+	"halligalli/assets"
+	"halligalli/common"
+	"halligalli/env"
+	"sort"
+	"strings"
+)
+
+const DefaultDeckProfile = "official"
+
+// DeckProfile builds a deck from the cards of the asset file
+type DeckProfile struct {
+	Name string
+	// Keep filters the cards of the asset file, nil keeps every card
+	Keep func(card common.Card) bool
+	// Copies is the number of copies of a card in the deck, nil takes Card.Repeat
+	Copies func(card common.Card) int
+}
+
+// DeckProfiles are the decks a channel can choose with "config deck"
+var DeckProfiles = []DeckProfile{
+	{
+		Name: DefaultDeckProfile,
+	},
+	{
+		Name:   "animal-heavy",
+		Copies: scaleAnimals(3),
+	},
+	{
+		Name: "no-animals",
+		Keep: func(card common.Card) bool {
+			return card.Type != common.Animal
+		},
+	},
+	{
+		// kids only count up to two fruits on a card
+		Name: "kids",
+		Keep: func(card common.Card) bool {
+			return card.Type == common.Animal || FruitsOn(card) <= 2
+		},
+		Copies: scaleAnimals(2),
+	},
+}
+
+func scaleAnimals(factor int) func(card common.Card) int {
+	return func(card common.Card) int {
+		if card.Type == common.Animal {
+			return Repeat(card) * factor
+		}
+		return Repeat(card)
+	}
+}
+
+// Repeat is the number of copies of the card in the official deck, cards without repeat are single
+func Repeat(card common.Card) int {
+	return max(card.Repeat, 1)
+}
+
+func FruitsOn(card common.Card) int {
+	number := 0
+	for _, element := range card.Elements {
+		number += element.Number
+	}
+	return number
+}
+
+// FindDeckProfile returns the profile of the name, the empty name being the default profile
+func FindDeckProfile(name string) (DeckProfile, bool) {
+	if name == "" {
+		name = DefaultDeckProfile
+	}
+	for _, profile := range DeckProfiles {
+		if profile.Name == name {
+			return profile, true
+		}
+	}
+	return DeckProfile{}, false
+}
+
+func DeckProfileNames() []string {
+	names := make([]string, len(DeckProfiles))
+	for index, profile := range DeckProfiles {
+		names[index] = profile.Name
+	}
+	return names
+}
+
+// Build expands the cards into the deck of the profile, unshuffled
+func (profile DeckProfile) Build(cards []common.Card) []common.Card {
+	deck := make([]common.Card, 0, len(cards))
+	for _, card := range cards {
+		if profile.Keep != nil && !profile.Keep(card) {
+			continue
+		}
+		copies := Repeat(card)
+		if profile.Copies != nil {
+			copies = profile.Copies(card)
+		}
+		for i := 0; i < copies; i++ {
+			deck = append(deck, card)
+		}
+	}
+	return deck
+}
+
+// BuildDeck builds the deck of the profile from the asset cards, the default deck if the profile is unknown
+func BuildDeck(name string) []common.Card {
+	profile, ok := FindDeckProfile(name)
+	if !ok {
+		profile, _ = FindDeckProfile(DefaultDeckProfile)
+	}
+	return profile.Build(env.GetContext().Asset.Cards)
+}
+
+// DeckReport describes the composition of a deck
+type DeckReport struct {
+	Profile string
+	Cards   int
+	// Fruits is the total of each fruit variant over the deck
+	Fruits  map[int]int
+	Animals int
+	// Unreachable are the fruit variants that can never add up to the number to win in the window
+	Unreachable []int
+}
+
+func (report DeckReport) AnimalRatio() float64 {
+	if report.Cards == 0 {
+		return 0
+	}
+	return float64(report.Animals) / float64(report.Cards)
+}
+
+func (report DeckReport) String() string {
+	variants := make([]int, 0, len(report.Fruits))
+	for variant := range report.Fruits {
+		variants = append(variants, variant)
+	}
+	sort.Ints(variants)
+	fruits := make([]string, len(variants))
+	for index, variant := range variants {
+		fruits[index] = fmt.Sprintf("%s %d", assets.GetFruitNameByVariant(variant), report.Fruits[variant])
+	}
+	text := fmt.Sprintf("deck %s: %d cards, fruits [%s], %d animals (%.1f%%)",
+		report.Profile, report.Cards, strings.Join(fruits, ", "), report.Animals, report.AnimalRatio()*100)
+	if len(report.Unreachable) > 0 {
+		text += fmt.Sprintf(", fruits %v cannot win", report.Unreachable)
+	}
+	return text
+}
+
+// CheckDeck counts the fruits and animals of the deck and finds the fruits that cannot win with the rule
+func CheckDeck(profile string, deck []common.Card, rule common.Rule) DeckReport {
+	report := DeckReport{
+		Profile: profile,
+		Cards:   len(deck),
+		Fruits:  make(map[int]int),
+	}
+	// numbers of each fruit variant on the cards holding it
+	numbers := make(map[int][]int)
+	for _, card := range deck {
+		if card.Type == common.Animal {
+			report.Animals += 1
+			continue
+		}
+		for _, element := range card.Elements {
+			report.Fruits[element.Variant] += element.Number
+			numbers[element.Variant] = append(numbers[element.Variant], element.Number)
+		}
+	}
+	for _, fruit := range env.GetContext().Asset.Meta.Fruits {
+		if !canReach(numbers[fruit.Variant], rule.ValidCardNumber, rule.FruitNumberToWin) {
+			report.Unreachable = append(report.Unreachable, fruit.Variant)
+		}
+	}
+	sort.Ints(report.Unreachable)
+	return report
+}
+
+// canReach tells if at most limit of the numbers add up to exactly the target
+func canReach(numbers []int, limit int, target int) bool {
+	// reachable[count][sum] for sums up to the target
+	reachable := make([][]bool, limit+1)
+	for count := range reachable {
+		reachable[count] = make([]bool, target+1)
+	}
+	reachable[0][0] = true
+	for _, number := range numbers {
+		for count := limit; count >= 1; count-- {
+			for sum := target; sum >= number; sum-- {
+				if reachable[count-1][sum-number] {
+					reachable[count][sum] = true
+				}
+			}
+		}
+	}
+	for count := range reachable {
+		if reachable[count][target] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package game
+
+import (
+	"encoding/json"
+	"halligalli/common"
+	"halligalli/env"
+	"os"
+	"testing"
+)
+
+func loadAssetCards(t *testing.T) []common.Card {
+	content, err := os.ReadFile("../assets/asset.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asset common.Asset
+	if err = json.Unmarshal(content, &asset); err != nil {
+		t.Fatal(err)
+	}
+	env.GetContext().Asset = asset
+	return asset.Cards
+}
+
+func TestDeckProfiles(t *testing.T) {
+	cards := loadAssetCards(t)
+	rule := common.Rule{ValidCardNumber: 5, FruitNumberToWin: 5}
+	reports := make(map[string]DeckReport)
+	for _, profile := range DeckProfiles {
+		reports[profile.Name] = CheckDeck(profile.Name, profile.Build(cards), rule)
+		if len(reports[profile.Name].Unreachable) > 0 {
+			t.Errorf("every fruit should be able to win with %s: %v", profile.Name, reports[profile.Name])
+		}
+	}
+
+	official := reports[DefaultDeckProfile]
+	if official.Cards != 56 || official.Animals != 8 {
+		t.Fatalf("official deck should hold 48 fruit cards and 8 animals: %v", official)
+	}
+	for variant, total := range official.Fruits {
+		if total != official.Fruits[1] {
+			t.Errorf("every fruit should be as frequent, fruit %d: %d: %v", variant, total, official)
+		}
+	}
+	if heavy := reports["animal-heavy"]; heavy.Cards != 48+24 || heavy.Animals != 24 {
+		t.Errorf("animal-heavy should triple the animals: %v", heavy)
+	}
+	if none := reports["no-animals"]; none.Cards != 48 || none.AnimalRatio() != 0 {
+		t.Errorf("no-animals should only hold the fruit cards: %v", none)
+	}
+	kids := reports["kids"]
+	if kids.Animals != 16 || kids.Cards <= kids.Animals {
+		t.Errorf("kids should double the animals: %v", kids)
+	}
+	for _, card := range BuildDeck("kids") {
+		if card.Type == common.Fruit && FruitsOn(card) > 2 {
+			t.Errorf("kids deck should not hold %+v", card)
+		}
+	}
+
+	hard := common.Rule{ValidCardNumber: 5, FruitNumberToWin: 15}
+	if report := CheckDeck("kids", BuildDeck("kids"), hard); len(report.Unreachable) != 4 {
+		t.Errorf("kids cards cannot add up to 15 fruits in 5 cards: %v", report)
+	}
+}
+
+func TestConfigureDeckRebuildsTheDeck(t *testing.T) {
+	cards := loadAssetCards(t)
+	noAnimals, _ := FindDeckProfile("no-animals")
+	game := &Game{ChannelId: "channel", State: WaitingForStart, NextCardIndex: 10}
+	messageChannel := make(chan Message, 2)
+	ConfigureRule(game, RuleConfig{Key: "deck", Value: "no-animals"}, messageChannel)
+	if message := <-messageChannel; message.MessageType != ShowRule || game.Rule.Deck != "no-animals" ||
+		len(game.Deck) != len(noAnimals.Build(cards)) || game.NextCardIndex != 0 {
+		t.Fatalf("deck should be rebuilt, got %+v with %d cards", message, len(game.Deck))
+	}
+	ConfigureRule(game, RuleConfig{Key: "deck", Value: "jumbo"}, messageChannel)
+	if message := <-messageChannel; message.MessageType != InvalidRule {
+		t.Fatalf("unknown deck should be refused, got %+v", message)
+	}
+}
+
+func TestDeckIsLockedOnceTheGameStarted(t *testing.T) {
+	loadAssetCards(t)
+	deck := BuildDeck(DefaultDeckProfile)
+	game := &Game{ChannelId: "channel", Deck: deck, NextCardIndex: 10}
+	messageChannel := make(chan Message, 1)
+	for _, state := range []State{Running, Arbitrating, Paused} {
+		game.State = state
+		ConfigureRule(game, RuleConfig{Key: "牌组", Value: "kids"}, messageChannel)
+		message := <-messageChannel
+		if ruleError, ok := message.Param.(RuleError); !ok || ruleError.Reason != RuleLocked || ruleError.Key != "deck" {
+			t.Fatalf("deck should be locked in state %d, got %+v", state, message)
+		}
+		if game.Rule.Deck != "" || len(game.Deck) != len(deck) || game.NextCardIndex != 10 {
+			t.Fatalf("deck should be left alone in state %d", state)
+		}
+	}
+}
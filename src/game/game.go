@@ -1,10 +1,12 @@
 package game
 
 import (
-	"halligalli/assets"
 	"halligalli/common"
 	"halligalli/env"
-	"log"
+	"halligalli/model"
+	"halligalli/rules"
+	"halligalli/storage"
+	"log/slog"
 	"math/rand"
 	"time"
 )
@@ -16,28 +18,44 @@ const (
 	WaitingForStart
 	Paused
 	Running
+	// Arbitrating collects competing rings before the round is decided
+	Arbitrating
 )
 
 type Game struct {
 	ChannelId     string
+	Reply         ReplyContext
 	Round         int
 	State         State
 	Deck          []common.Card
 	NextCardIndex int
-	RevealTimer   *time.Timer
 	RevealedCards []common.Card
+	RevealedAt    []time.Time
+	Scores        map[string]*PlayerScore
+	Mode          Mode
+	Roster        []model.User
+	Players       []model.User
+	Hands         map[string][]common.Card
+	Turn          int
+	Rule          common.Rule
+	Rings         []Ring
+	Stats         map[string]*PlayerStats
+	Record        storage.GameRecord
 }
 
 func (game *Game) Init(channelId string) {
 	game.ChannelId = channelId
+	game.Reply = ReplyContext{ChannelId: channelId}
 	game.State = Closed
-	game.Deck = make([]common.Card, len(env.GetContext().Asset.Cards))
-	copy(game.Deck, env.GetContext().Asset.Cards)
+	game.Mode = Classic
+	game.Rule = env.GetContext().GameRule
+	game.Deck = BuildDeck(game.Rule.Deck)
 	game.ShuffleDeck()
 	game.NextCardIndex = 0
-	game.RevealTimer = time.NewTimer(env.GetContext().GameRule.DealInterval)
-	game.RevealTimer.Stop()
 	game.RevealedCards = make([]common.Card, 0)
+	game.RevealedAt = make([]time.Time, 0)
+	game.ResetScores()
+	game.Stats = make(map[string]*PlayerStats)
 }
 
 func (game *Game) ShuffleDeck() {
@@ -57,82 +75,32 @@ func (game *Game) RevealNextCard() common.Card {
 		game.RevealedCards = make([]common.Card, 0)
 	}
 	game.RevealedCards = append(game.RevealedCards, card)
+	game.RevealedAt = append(game.RevealedAt, time.Now())
 	game.NextCardIndex += 1
 	return card
 }
 
-type Counter struct {
-	Variant int
-	Count   int
-}
-
-func GetFruitCounters() []Counter {
-	result := make([]Counter, len(env.GetContext().Asset.Meta.Fruits))
-	for index, fruit := range env.GetContext().Asset.Meta.Fruits {
-		result[index].Variant = fruit.Variant
-		result[index].Count = 0
-	}
-	return result
-}
-
-func CountFruit(variant int, number int, fruitCounters *[]Counter) {
-	for _, fruitCounter := range *fruitCounters {
-		if fruitCounter.Variant == variant {
-			fruitCounter.Count += number
-		}
-	}
-}
-
-// WinCheck returns (isWin, animalName, fruitName)
-func (game *Game) WinCheck() (bool, string, string) {
-	validCards := game.GetValidCards()
+// WinCheck returns (isWin, animal, fruit), the variants being 0 if they did not win
+func (game *Game) WinCheck() (bool, int, int) {
+	verdict := rules.Check(game.GetValidCards(), game.Rule)
+	slog.Debug("win check", "verdict", verdict)
 
-	hasAnimal := false
-	animalVariant := -1
-	fruitCounters := GetFruitCounters()
-
-	for _, card := range validCards {
-		if card.Type == common.Fruit {
-			for _, element := range card.Elements {
-				CountFruit(element.Variant, element.Number, &fruitCounters)
-			}
-		} else if card.Type == common.Animal {
-			hasAnimal = true
-			animalVariant = card.Variant
-		}
-	}
-	log.Printf("has animal: %t", hasAnimal)
-
-	if hasAnimal {
-		animalName := assets.GetAnimalNameByVariant(animalVariant)
-		return true, animalName, ""
+	if verdict.HasAnimal() {
+		return true, verdict.Animals[len(verdict.Animals)-1], 0
 	}
-
-	for _, counter := range fruitCounters {
-		log.Printf("fruit counter: %d %d", counter.Variant, counter.Count)
-		if counter.Count == env.GetContext().GameRule.FruitNumberToWin {
-			fruitName := assets.GetFruitNameByVariant(counter.Variant)
-			return true, "", fruitName
-		}
+	if verdict.HasFruit() {
+		return true, 0, verdict.Fruits[0]
 	}
-
-	return false, "", ""
+	return false, 0, 0
 }
 
 func (game *Game) GetValidCards() []common.Card {
-	sliceFrom := maxInt(0, len(game.RevealedCards)-env.GetContext().GameRule.ValidCardNumber)
-	validCards := game.RevealedCards[sliceFrom:]
-	return validCards
+	return rules.Window(game.RevealedCards, game.Rule)
 }
 
+// NewRound clears the table, cards revealed before are no longer part of the game
 func (game *Game) NewRound() {
+	game.Round += 1
 	game.RevealedCards = nil
-}
-
-func maxInt(a, b int) int {
-	if a > b {
-		return a
-	} else {
-		return b
-	}
+	game.RevealedAt = nil
 }
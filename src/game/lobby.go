@@ -0,0 +1,76 @@
+package game
+
+import (
+	"errors"
+	"halligalli/model"
+)
+
+var (
+	ErrAlreadyJoined = errors.New("player already joined")
+	ErrNotJoined     = errors.New("player not joined")
+	ErrLobbyFull     = errors.New("lobby is full")
+)
+
+type RosterStatus struct {
+	Players    []model.User
+	MinPlayers int
+	MaxPlayers int
+}
+
+func (game *Game) Join(player model.User) error {
+	if game.IsRegistered(player) {
+		return ErrAlreadyJoined
+	}
+	maxPlayers := game.Rule.MaxPlayers
+	if maxPlayers > 0 && len(game.Roster) >= maxPlayers {
+		return ErrLobbyFull
+	}
+	game.Roster = append(game.Roster, player)
+	return nil
+}
+
+func (game *Game) Leave(player model.User) error {
+	for index, current := range game.Roster {
+		if current.Id == player.Id {
+			game.Roster = append(game.Roster[:index], game.Roster[index+1:]...)
+			return nil
+		}
+	}
+	return ErrNotJoined
+}
+
+func (game *Game) IsRegistered(player model.User) bool {
+	for _, current := range game.Roster {
+		if current.Id == player.Id {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRing tells registered players from spectators
+func (game *Game) CanRing(player model.User) bool {
+	if game.Mode == Tabletop {
+		return game.IsPlayer(player)
+	}
+	return game.IsRegistered(player)
+}
+
+// GetMinPlayers returns the number of players required to start the game
+func (game *Game) GetMinPlayers() int {
+	minPlayers := game.Rule.MinPlayers
+	if game.Mode == Tabletop && minPlayers < MinTabletopPlayers {
+		minPlayers = MinTabletopPlayers
+	}
+	return minPlayers
+}
+
+func (game *Game) GetRosterStatus() RosterStatus {
+	players := make([]model.User, len(game.Roster))
+	copy(players, game.Roster)
+	return RosterStatus{
+		Players:    players,
+		MinPlayers: game.GetMinPlayers(),
+		MaxPlayers: game.Rule.MaxPlayers,
+	}
+}
@@ -0,0 +1,88 @@
+package game
+
+import (
+	"errors"
+	"halligalli/common"
+	"halligalli/model"
+	"testing"
+)
+
+func TestJoinAndLeave(t *testing.T) {
+	game := &Game{Rule: common.Rule{MaxPlayers: 2}}
+	if err := game.Join(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Join(model.User{Id: "alice", UserName: "renamed"}); !errors.Is(err, ErrAlreadyJoined) {
+		t.Fatalf("player should join once, got %v", err)
+	}
+	if err := game.Join(bob); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Join(carol); !errors.Is(err, ErrLobbyFull) {
+		t.Fatalf("third player should not fit, got %v", err)
+	}
+	if !game.IsRegistered(bob) || game.IsRegistered(carol) || !game.CanRing(alice) || game.CanRing(carol) {
+		t.Fatalf("only joined players should ring, got %+v", game.Roster)
+	}
+
+	if err := game.Leave(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := game.Leave(alice); !errors.Is(err, ErrNotJoined) {
+		t.Fatalf("player should leave once, got %v", err)
+	}
+	if err := game.Join(carol); err != nil {
+		t.Fatalf("leaving should make room, got %v", err)
+	}
+	status := game.GetRosterStatus()
+	if len(status.Players) != 2 || status.Players[0].Id != "bob" || status.Players[1].Id != "carol" || status.MaxPlayers != 2 {
+		t.Fatalf("players should be kept in joining order, got %+v", status)
+	}
+	status.Players[0] = alice
+	if game.Roster[0].Id != "bob" {
+		t.Fatalf("roster status should be a copy")
+	}
+}
+
+func TestLobbyWithoutLimit(t *testing.T) {
+	game := &Game{}
+	for i := 0; i < 20; i++ {
+		if err := game.Join(model.User{Id: string(rune('a' + i))}); err != nil {
+			t.Fatalf("player %d should join without a limit, got %v", i, err)
+		}
+	}
+}
+
+func TestMinPlayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     Mode
+		rule     int
+		expected int
+	}{
+		{name: "classic without minimum", mode: Classic, rule: 0, expected: 0},
+		{name: "classic follows the rule", mode: Classic, rule: 3, expected: 3},
+		{name: "tabletop needs two players", mode: Tabletop, rule: 1, expected: MinTabletopPlayers},
+		{name: "tabletop follows a higher rule", mode: Tabletop, rule: 4, expected: 4},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game := &Game{Mode: test.mode, Rule: common.Rule{MinPlayers: test.rule}}
+			if minPlayers := game.GetMinPlayers(); minPlayers != test.expected || game.GetRosterStatus().MinPlayers != test.expected {
+				t.Fatalf("expected %d players at least, got %d", test.expected, minPlayers)
+			}
+		})
+	}
+}
+
+func TestStartGameNeedsMinPlayers(t *testing.T) {
+	game := &Game{Mode: Tabletop, Roster: []model.User{alice}}
+	messageChannel := make(chan Message, 8)
+	if StartGame(game, messageChannel) {
+		t.Fatalf("tabletop game should not start alone")
+	}
+	message := <-messageChannel
+	if status, ok := message.Param.(RosterStatus); message.MessageType != NotEnoughPlayers || !ok || status.MinPlayers != MinTabletopPlayers {
+		t.Fatalf("missing players should be reported, got %+v", message)
+	}
+}
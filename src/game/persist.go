@@ -0,0 +1,151 @@
+package game
+
+import (
+	"encoding/json"
+	"halligalli/env"
+	"halligalli/model"
+	"halligalli/storage"
+	"log/slog"
+	"time"
+)
+
+// SaveSnapshot keeps the game in the store so that it survives a restart or the actor
+// being reaped, the snapshot is the only place where the rule and stats of the channel are kept
+func SaveSnapshot(game *Game) {
+	store := env.GetContext().Store
+	if store == nil {
+		return
+	}
+	snapshot, err := json.Marshal(game)
+	if err != nil {
+		slog.Error("building snapshot", "err", err)
+		return
+	}
+	if err = store.SaveSnapshot(game.ChannelId, snapshot); err != nil {
+		slog.Error("saving snapshot", "err", err)
+	}
+}
+
+// restoreSnapshot parses the snapshot of a game, a game that was dealing is paused
+// as its timers did not survive, the players continue it when they are back
+func restoreSnapshot(snapshot []byte) (*Game, error) {
+	game := &Game{}
+	if err := json.Unmarshal(snapshot, game); err != nil {
+		return nil, err
+	}
+	if game.State == Running || game.State == Arbitrating {
+		game.State = Paused
+		game.Rings = nil
+	}
+	return game, nil
+}
+
+// RestoreGames loads the games that were going on or waiting for start before the restart
+func RestoreGames() map[string]*Game {
+	gameInstances := make(map[string]*Game)
+	store := env.GetContext().Store
+	if store == nil {
+		return gameInstances
+	}
+	snapshots, err := store.LoadSnapshots()
+	if err != nil {
+		slog.Error("loading snapshots", "err", err)
+		return gameInstances
+	}
+	for channelId, snapshot := range snapshots {
+		game, err := restoreSnapshot(snapshot)
+		if err != nil {
+			slog.Error("parsing snapshot", "channel", channelId, "err", err)
+			continue
+		}
+		if game.State != Paused && game.State != WaitingForStart {
+			continue
+		}
+		gameInstances[channelId] = game
+		slog.Info("game restored", "channel", channelId)
+	}
+	return gameInstances
+}
+
+// LoadGame restores the game of the channel from its snapshot or creates a new one
+func LoadGame(channelId string) *Game {
+	if store := env.GetContext().Store; store != nil {
+		snapshot, ok, err := store.LoadSnapshot(channelId)
+		if err != nil {
+			slog.Error("loading snapshot", "channel", channelId, "err", err)
+		}
+		if ok {
+			game, err := restoreSnapshot(snapshot)
+			if err == nil {
+				return game
+			}
+			slog.Error("restoring snapshot", "channel", channelId, "err", err)
+		}
+	}
+	game := &Game{}
+	game.Init(channelId)
+	return game
+}
+
+func RecordRound(game *Game, rings []Ring, roundStatus RoundStatus) {
+	round := storage.RoundRecord{
+		Number:   len(game.Record.Rounds) + 1,
+		PlayerId: roundStatus.Player.Id,
+		IsWin:    roundStatus.IsWin,
+		Animal:   roundStatus.AnimalName,
+		Fruit:    roundStatus.FruitName,
+		Rings:    make([]storage.RingRecord, len(rings)),
+		EndedAt:  time.Now(),
+	}
+	for index, ring := range rings {
+		round.Rings[index] = storage.RingRecord{
+			PlayerId:  ring.Player.Id,
+			Timestamp: ring.Timestamp,
+			Seq:       ring.Seq,
+		}
+	}
+	game.Record.Rounds = append(game.Record.Rounds, round)
+}
+
+// FinishRecord saves the record of a game that has been played
+func FinishRecord(game *Game) {
+	if game.Record.StartedAt.IsZero() {
+		return
+	}
+	game.Record.EndedAt = time.Now()
+	for _, score := range game.GetStandings() {
+		game.Record.Scores = append(game.Record.Scores, storage.ScoreRecord{
+			PlayerId:  score.Player.Id,
+			Score:     score.Score,
+			Wins:      score.Wins,
+			FakeRings: score.FakeRings,
+		})
+	}
+	for _, player := range game.Roster {
+		UpdateProfile(player, func(profile *storage.PlayerProfile) {
+			profile.Games += 1
+		})
+	}
+	if store := env.GetContext().Store; store != nil {
+		if err := store.SaveGame(game.Record); err != nil {
+			slog.Error("saving game record", "err", err)
+		}
+	}
+	game.Record = storage.GameRecord{}
+}
+
+func UpdateProfile(player model.User, update func(profile *storage.PlayerProfile)) {
+	store := env.GetContext().Store
+	if store == nil {
+		return
+	}
+	_, err := store.UpdateProfile(player.Id, func(profile *storage.PlayerProfile) {
+		if player.UserName != "" {
+			profile.UserName = player.UserName
+		}
+		update(profile)
+	})
+	if err != nil {
+		slog.Error("saving profile", "err", err)
+	}
+}
@@ -0,0 +1,49 @@
+package game
+
+import (
+	"halligalli/env"
+	"halligalli/model"
+	"halligalli/storage"
+	"testing"
+	"time"
+)
+
+func TestRunningGameIsRestoredPaused(t *testing.T) {
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := env.GetContext()
+	previousStore := context.Store
+	context.Store = store
+	defer func() {
+		context.Store = previousStore
+	}()
+
+	player := model.User{Id: "player"}
+	game := &Game{}
+	game.Init("channel")
+	game.State = Arbitrating
+	game.Rule.Locale = "en"
+	game.Rule.DealInterval = 5 * time.Second
+	game.Rings = []Ring{{Player: player}}
+	game.Stats["player"] = &PlayerStats{Player: player, Reactions: 1, Total: time.Second, Best: time.Second}
+	SaveSnapshot(game)
+
+	restored, ok := RestoreGames()["channel"]
+	if !ok {
+		t.Fatal("game that was arbitrating should be restored")
+	}
+	loaded := LoadGame("channel")
+	for _, game := range []*Game{restored, loaded} {
+		if game.State != Paused || len(game.Rings) != 0 {
+			t.Errorf("game should be paused without rings, state %d, rings %+v", game.State, game.Rings)
+		}
+		if game.Rule.Locale != "en" || game.Rule.DealInterval != 5*time.Second {
+			t.Errorf("rule of the channel should be kept: %+v", game.Rule)
+		}
+		if stats := game.Stats["player"]; stats == nil || stats.Reactions != 1 || stats.Best != time.Second {
+			t.Errorf("stats of the channel should be kept: %+v", game.Stats)
+		}
+	}
+}
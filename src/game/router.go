@@ -0,0 +1,243 @@
+package game
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	ActorInboxSize = 32
+	// ActorOutboxSize is the number of messages of a game waiting to be handled
+	ActorOutboxSize = 32
+	// MaxActorBacklog is the number of events kept for an actor whose inbox is full
+	MaxActorBacklog      = 1024
+	BacklogFlushInterval = 50 * time.Millisecond
+	DefaultIdleTimeout   = 10 * time.Minute
+	DefaultReapInterval  = time.Minute
+	// RedeliverDelay postpones a due timer whose actor backlog is full
+	RedeliverDelay = 100 * time.Millisecond
+)
+
+// ErrChannelBusy is returned when an actor cannot keep up with the events of its channel
+var ErrChannelBusy = errors.New("channel is busy")
+
+type scheduleRequest struct {
+	Timer
+	Cancel bool
+}
+
+// Actor owns the game of a single channel and handles its events and timers one at a time
+type Actor struct {
+	Game  *Game
+	Inbox chan any
+	// requests relays the timers of the game to the router owning the scheduler
+	requests chan scheduleRequest
+	// previous is the reaped actor of the same channel that may still be saving its game
+	previous   *Actor
+	lastRouted time.Time
+	done       chan bool
+	// backlog keeps in order the events routed while the inbox was full, it belongs to the router
+	backlog []any
+	// generation changes with every timer of the game, a timer of an earlier generation was replaced or cancelled
+	generation int
+}
+
+func (actor *Actor) Schedule(channelId string, kind TimerKind, at time.Time) {
+	actor.generation += 1
+	actor.requests <- scheduleRequest{Timer: Timer{ChannelId: channelId, Kind: kind, At: at, Generation: actor.generation}}
+}
+
+func (actor *Actor) Cancel(channelId string) {
+	actor.generation += 1
+	actor.requests <- scheduleRequest{Timer: Timer{ChannelId: channelId}, Cancel: true}
+}
+
+// Run handles the events and timers of the game until the inbox is closed,
+// the messages of the game are sent to messageChannel which is closed once done
+func (actor *Actor) Run(channelId string, messageChannel chan Message) {
+	defer close(actor.done)
+	defer close(messageChannel)
+	if actor.previous != nil {
+		<-actor.previous.done
+		actor.previous = nil
+	}
+	if actor.Game == nil {
+		actor.Game = LoadGame(channelId)
+	}
+	for message := range actor.Inbox {
+		switch message := message.(type) {
+		case Event:
+			HandleEvent(actor.Game, message, actor, messageChannel)
+		case Timer:
+			// the timer may have been queued before the game stopped and started again
+			if message.Generation != actor.generation {
+				slog.Info("ignored stale timer", "channel", channelId)
+				continue
+			}
+			HandleTimer(actor.Game, message, actor, messageChannel)
+		}
+	}
+}
+
+// Router dispatches events to the actor of their channel, creating actors on demand
+// and reaping them after being idle, it never blocks on a single actor
+type Router struct {
+	Actors    map[string]*Actor
+	Scheduler *Scheduler
+	// HandleMessages sends the messages of a single game, it runs along with the actor of the game
+	// so that a channel slow to send to does not hold back the games of other channels
+	HandleMessages func(messageChannel chan Message)
+	IdleTimeout    time.Duration
+	ReapInterval   time.Duration
+	retiring       map[string]*Actor
+	backlogged     map[string]*Actor
+	requests       chan scheduleRequest
+}
+
+func NewRouter(handleMessages func(messageChannel chan Message)) *Router {
+	return &Router{
+		Actors:         make(map[string]*Actor),
+		Scheduler:      NewScheduler(),
+		HandleMessages: handleMessages,
+		IdleTimeout:    DefaultIdleTimeout,
+		ReapInterval:   DefaultReapInterval,
+		retiring:       make(map[string]*Actor),
+		backlogged:     make(map[string]*Actor),
+		requests:       make(chan scheduleRequest, 256),
+	}
+}
+
+func (router *Router) Run(eventChannel chan Event) {
+	for channelId, game := range RestoreGames() {
+		router.Spawn(channelId, game)
+	}
+	wakeup := time.NewTimer(time.Hour)
+	reapTicker := time.NewTicker(router.ReapInterval)
+	defer reapTicker.Stop()
+	flushTicker := time.NewTicker(BacklogFlushInterval)
+	defer flushTicker.Stop()
+	for {
+		ResetWakeup(wakeup, router.Scheduler)
+		select {
+		case event := <-eventChannel:
+			if err := router.Route(event); err != nil {
+				slog.Error("dropped event", "type", event.EventType, "channel", event.ChannelId, "err", err)
+			}
+		case request := <-router.requests:
+			if request.Cancel {
+				router.Scheduler.Cancel(request.ChannelId)
+			} else {
+				router.Scheduler.ScheduleTimer(request.Timer)
+			}
+		case now := <-wakeup.C:
+			for _, timer := range router.Scheduler.PopDue(now) {
+				router.Deliver(timer, now)
+			}
+		case <-flushTicker.C:
+			router.Flush()
+		case now := <-reapTicker.C:
+			router.Reap(now)
+		}
+	}
+}
+
+func (router *Router) Spawn(channelId string, game *Game) *Actor {
+	actor := &Actor{
+		Game:       game,
+		Inbox:      make(chan any, ActorInboxSize),
+		requests:   router.requests,
+		previous:   router.retiring[channelId],
+		lastRouted: time.Now(),
+		done:       make(chan bool),
+	}
+	router.Actors[channelId] = actor
+	messageChannel := make(chan Message, ActorOutboxSize)
+	go router.HandleMessages(messageChannel)
+	go actor.Run(channelId, messageChannel)
+	return actor
+}
+
+// Route queues the event for the actor of its channel, events wait in the backlog of the actor
+// while its inbox is full, ErrChannelBusy is returned once the backlog is full too
+func (router *Router) Route(event Event) error {
+	actor := router.Actors[event.ChannelId]
+	if actor == nil {
+		actor = router.Spawn(event.ChannelId, nil)
+	}
+	actor.lastRouted = time.Now()
+	return router.enqueue(event.ChannelId, actor, event)
+}
+
+func (router *Router) Deliver(timer Timer, now time.Time) {
+	actor := router.Actors[timer.ChannelId]
+	if actor == nil {
+		return
+	}
+	actor.lastRouted = now
+	if router.enqueue(timer.ChannelId, actor, timer) != nil {
+		timer.At = now.Add(RedeliverDelay)
+		router.Scheduler.ScheduleTimer(timer)
+	}
+}
+
+// enqueue never puts a message before the backlog, so that the actor gets them in order
+func (router *Router) enqueue(channelId string, actor *Actor, message any) error {
+	if len(actor.backlog) == 0 {
+		select {
+		case actor.Inbox <- message:
+			return nil
+		default:
+		}
+	}
+	if len(actor.backlog) >= MaxActorBacklog {
+		return ErrChannelBusy
+	}
+	actor.backlog = append(actor.backlog, message)
+	router.backlogged[channelId] = actor
+	return nil
+}
+
+// Flush moves the backlogs into the inboxes that have room again
+func (router *Router) Flush() {
+	for channelId, actor := range router.backlogged {
+		for len(actor.backlog) > 0 {
+			select {
+			case actor.Inbox <- actor.backlog[0]:
+				actor.backlog[0] = nil
+				actor.backlog = actor.backlog[1:]
+				continue
+			default:
+			}
+			break
+		}
+		if len(actor.backlog) == 0 {
+			actor.backlog = nil
+			delete(router.backlogged, channelId)
+		}
+	}
+}
+
+// Reap stops the actors that have not received anything for the idle timeout,
+// games waiting for a deal, an arbitration or their backlog are never reaped
+func (router *Router) Reap(now time.Time) {
+	for channelId, actor := range router.retiring {
+		select {
+		case <-actor.done:
+			delete(router.retiring, channelId)
+		default:
+		}
+	}
+	for channelId, actor := range router.Actors {
+		if now.Sub(actor.lastRouted) < router.IdleTimeout || router.Scheduler.Pending(channelId) || len(actor.backlog) > 0 {
+			continue
+		}
+		close(actor.Inbox)
+		delete(router.Actors, channelId)
+		router.retiring[channelId] = actor
+	}
+}
+
+func MainLoop(eventChannel chan Event, handleMessages func(messageChannel chan Message)) {
+	NewRouter(handleMessages).Run(eventChannel)
+}
@@ -0,0 +1,111 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/model"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func useTestDeck(t *testing.T) {
+	env.GetContext().Asset = common.Asset{
+		Cards: []common.Card{
+			{Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 1}}},
+			{Type: common.Fruit, Elements: []common.CardElement{{Variant: 2, Number: 2}}},
+		},
+	}
+	env.GetContext().GameRule.DealInterval = time.Hour
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func receive(t *testing.T, messages chan Message) Message {
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no message received")
+	}
+	return Message{}
+}
+
+func TestBlockedChannelDoesNotStallOthers(t *testing.T) {
+	useTestDeck(t)
+	release := make(chan bool)
+	slow := make(chan Message, 1024)
+	fast := make(chan Message, 1024)
+	router := NewRouter(func(messages chan Message) {
+		for message := range messages {
+			if message.ChannelId == "slow" {
+				<-release
+				slow <- message
+			} else {
+				fast <- message
+			}
+		}
+	})
+	eventChannel := make(chan Event)
+	go router.Run(eventChannel)
+
+	// far more events than the inbox and the messages of the slow channel can hold
+	const events = ActorInboxSize + ActorOutboxSize + 100
+	for i := 0; i < events; i++ {
+		eventChannel <- Event{EventType: Score, ReplyContext: ReplyContext{ChannelId: "slow", MessageId: "slow"}}
+	}
+	eventChannel <- Event{EventType: Score, ReplyContext: ReplyContext{ChannelId: "fast", MessageId: "fast"}}
+	if message := receive(t, fast); message.MessageType != ShowScore {
+		t.Fatalf("fast channel should be answered, got %+v", message)
+	}
+
+	// once the slow channel sends again none of its events is lost
+	close(release)
+	for i := 0; i < events; i++ {
+		if message := receive(t, slow); message.MessageType != ShowScore {
+			t.Fatalf("unexpected message %+v", message)
+		}
+	}
+}
+
+func TestStaleTimerIsIgnored(t *testing.T) {
+	useTestDeck(t)
+	messages := make(chan Message, 64)
+	router := NewRouter(func(actorMessages chan Message) {
+		for message := range actorMessages {
+			messages <- message
+		}
+	})
+	actor := router.Spawn("channel", nil)
+	reply := ReplyContext{ChannelId: "channel"}
+	player := model.User{Id: "player"}
+	start := func() {
+		actor.Inbox <- Event{EventType: Initiate, ReplyContext: reply, Param: Classic}
+		actor.Inbox <- Event{EventType: Join, ReplyContext: reply, Param: player}
+		actor.Inbox <- Event{EventType: Start, ReplyContext: reply}
+		for receive(t, messages).MessageType != CardRevealed {
+		}
+	}
+	start()
+	stale := (<-router.requests).Timer
+	actor.Inbox <- Event{EventType: Terminate, ReplyContext: reply}
+	start()
+
+	// the deal timer of the first game was already on its way when it stopped
+	actor.Inbox <- stale
+	actor.Inbox <- Event{EventType: Score, ReplyContext: reply}
+	for message := receive(t, messages); message.MessageType != ShowScore; message = receive(t, messages) {
+		if message.MessageType == CardRevealed {
+			t.Fatalf("stale timer should not reveal a card")
+		}
+	}
+
+	<-router.requests
+	current := (<-router.requests).Timer
+	actor.Inbox <- current
+	for receive(t, messages).MessageType != CardRevealed {
+	}
+	close(actor.Inbox)
+}
@@ -0,0 +1,169 @@
+package game
+
+import (
+	"fmt"
+	"halligalli/common"
+	"halligalli/locale"
+	"strconv"
+	"time"
+)
+
+const (
+	MinDealInterval     = 2 * time.Second
+	MaxDealInterval     = time.Minute
+	MinValidCardNumber  = 1
+	MaxValidCardNumber  = 10
+	MinFruitNumberToWin = 2
+	MaxFruitNumberToWin = 15
+)
+
+// RuleConfig changes a single field of the game rule, an empty key shows the current rule
+type RuleConfig struct {
+	Key   string
+	Value string
+}
+
+type RuleErrorReason = string
+
+const (
+	// RuleLocked is reported while a game is running
+	RuleLocked       RuleErrorReason = "locked"
+	UnknownRuleKey   RuleErrorReason = "unknown_key"
+	InvalidRuleValue RuleErrorReason = "invalid_value"
+	RuleOutOfRange   RuleErrorReason = "out_of_range"
+)
+
+// RuleError tells why the rule cannot be changed, Key is the english name of the setting once it is known
+type RuleError struct {
+	Reason RuleErrorReason
+	Key    string
+	Value  string
+	// Min and Max bound the values of RuleOutOfRange
+	Min any
+	Max any
+}
+
+func (err *RuleError) Error() string {
+	switch err.Reason {
+	case RuleLocked:
+		if err.Key == "deck" {
+			return "the deck cannot be changed once the game has started"
+		}
+		return "the rule cannot be changed while the game is running"
+	case UnknownRuleKey:
+		return fmt.Sprintf("unknown setting %q", err.Key)
+	case RuleOutOfRange:
+		return fmt.Sprintf("%s should be between %v and %v", err.Key, err.Min, err.Max)
+	}
+	return fmt.Sprintf("invalid %s %q", err.Key, err.Value)
+}
+
+// CheckRuleLocked returns a RuleLocked error if the setting cannot be changed in the current state of the game,
+// the deck is dealt when the game starts so it can only be changed before, while the display and locale
+// only change how the next messages look and can be changed at any time
+func (game *Game) CheckRuleLocked(key string, value string) error {
+	switch key {
+	case "display", "显示", "locale", "语言":
+		return nil
+	case "deck", "牌组":
+		if game.State != Closed && game.State != WaitingForStart {
+			return &RuleError{Reason: RuleLocked, Key: "deck", Value: value}
+		}
+		return nil
+	}
+	if game.State == Running || game.State == Arbitrating {
+		return &RuleError{Reason: RuleLocked, Key: key, Value: value}
+	}
+	return nil
+}
+
+// SetRule validates the value and applies it to the rule of this game
+func (game *Game) SetRule(key string, value string) error {
+	switch key {
+	case "interval", "间隔":
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			// plain numbers are taken as seconds
+			seconds, numberErr := strconv.Atoi(value)
+			if numberErr != nil {
+				return &RuleError{Reason: InvalidRuleValue, Key: "interval", Value: value}
+			}
+			interval = time.Duration(seconds) * time.Second
+		}
+		if interval < MinDealInterval || interval > MaxDealInterval {
+			return &RuleError{Reason: RuleOutOfRange, Key: "interval", Value: value, Min: MinDealInterval, Max: MaxDealInterval}
+		}
+		game.Rule.DealInterval = interval
+	case "window", "窗口":
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return &RuleError{Reason: InvalidRuleValue, Key: "window", Value: value}
+		}
+		if number < MinValidCardNumber || number > MaxValidCardNumber {
+			return &RuleError{Reason: RuleOutOfRange, Key: "window", Value: value, Min: MinValidCardNumber, Max: MaxValidCardNumber}
+		}
+		game.Rule.ValidCardNumber = number
+	case "target", "目标":
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return &RuleError{Reason: InvalidRuleValue, Key: "target", Value: value}
+		}
+		if number < MinFruitNumberToWin || number > MaxFruitNumberToWin {
+			return &RuleError{Reason: RuleOutOfRange, Key: "target", Value: value, Min: MinFruitNumberToWin, Max: MaxFruitNumberToWin}
+		}
+		game.Rule.FruitNumberToWin = number
+	case "display", "显示":
+		display, ok := ParseDisplayMode(value)
+		if !ok {
+			return &RuleError{Reason: InvalidRuleValue, Key: "display", Value: value}
+		}
+		game.Rule.Display = display
+	case "deck", "牌组":
+		profile, ok := FindDeckProfile(value)
+		if !ok {
+			return &RuleError{Reason: InvalidRuleValue, Key: "deck", Value: value}
+		}
+		game.Rule.Deck = profile.Name
+		game.Deck = BuildDeck(profile.Name)
+		game.ShuffleDeck()
+		game.NextCardIndex = 0
+	case "locale", "语言":
+		name, err := ParseLocale(value)
+		if err != nil {
+			return err
+		}
+		game.Rule.Locale = name
+	default:
+		return &RuleError{Reason: UnknownRuleKey, Key: key, Value: value}
+	}
+	return nil
+}
+
+// ParseDisplayMode accepts the display modes in English or Chinese
+func ParseDisplayMode(value string) (common.DisplayMode, bool) {
+	switch value {
+	case common.DisplayImage, "图片":
+		return common.DisplayImage, true
+	case common.DisplayText, "文字":
+		return common.DisplayText, true
+	case common.DisplayBoth, "图片和文字", "全部":
+		return common.DisplayBoth, true
+	}
+	return "", false
+}
+
+// ParseLocale returns the locale to use, "default" returns an empty locale to follow the guild or the bot
+func ParseLocale(value string) (string, error) {
+	switch value {
+	case "default", "默认":
+		return "", nil
+	case "中文":
+		return locale.Chinese, nil
+	case "english", "英文":
+		return locale.English, nil
+	}
+	if !locale.IsKnown(value) {
+		return "", &RuleError{Reason: InvalidRuleValue, Key: "locale", Value: value}
+	}
+	return value, nil
+}
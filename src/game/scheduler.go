@@ -0,0 +1,136 @@
+package game
+
+import (
+	"container/heap"
+	"time"
+)
+
+type TimerKind = int
+
+const (
+	// DealTimer reveals the next card when it is due
+	DealTimer TimerKind = iota
+	// ArbitrationTimer resolves the collected rings when it is due
+	ArbitrationTimer
+)
+
+type Timer struct {
+	ChannelId string
+	Kind      TimerKind
+	At        time.Time
+	// Generation tells the timers of a game apart, a game only handles its latest timer
+	Generation int
+	index      int
+}
+
+type timerHeap []*Timer
+
+func (timers timerHeap) Len() int {
+	return len(timers)
+}
+
+func (timers timerHeap) Less(i, j int) bool {
+	return timers[i].At.Before(timers[j].At)
+}
+
+func (timers timerHeap) Swap(i, j int) {
+	timers[i], timers[j] = timers[j], timers[i]
+	timers[i].index = i
+	timers[j].index = j
+}
+
+func (timers *timerHeap) Push(x any) {
+	timer := x.(*Timer)
+	timer.index = len(*timers)
+	*timers = append(*timers, timer)
+}
+
+func (timers *timerHeap) Pop() any {
+	old := *timers
+	timer := old[len(old)-1]
+	old[len(old)-1] = nil
+	timer.index = -1
+	*timers = old[:len(old)-1]
+	return timer
+}
+
+// Scheduler keeps at most one pending timer per channel ordered by deadline,
+// it is not safe for concurrent use and is meant to be owned by a single loop
+type Scheduler struct {
+	timers    timerHeap
+	byChannel map[string]*Timer
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{
+		timers:    make(timerHeap, 0),
+		byChannel: make(map[string]*Timer),
+	}
+}
+
+// Schedule replaces the pending timer of the channel
+func (scheduler *Scheduler) Schedule(channelId string, kind TimerKind, at time.Time) {
+	scheduler.ScheduleTimer(Timer{ChannelId: channelId, Kind: kind, At: at})
+}
+
+// ScheduleTimer replaces the pending timer of the channel of the timer
+func (scheduler *Scheduler) ScheduleTimer(timer Timer) {
+	if pending, ok := scheduler.byChannel[timer.ChannelId]; ok {
+		pending.Kind = timer.Kind
+		pending.At = timer.At
+		pending.Generation = timer.Generation
+		heap.Fix(&scheduler.timers, pending.index)
+		return
+	}
+	heap.Push(&scheduler.timers, &timer)
+	scheduler.byChannel[timer.ChannelId] = &timer
+}
+
+func (scheduler *Scheduler) Cancel(channelId string) {
+	timer, ok := scheduler.byChannel[channelId]
+	if !ok {
+		return
+	}
+	heap.Remove(&scheduler.timers, timer.index)
+	delete(scheduler.byChannel, channelId)
+}
+
+func (scheduler *Scheduler) Pending(channelId string) bool {
+	_, ok := scheduler.byChannel[channelId]
+	return ok
+}
+
+func (scheduler *Scheduler) Len() int {
+	return len(scheduler.timers)
+}
+
+func (scheduler *Scheduler) NextDeadline() (time.Time, bool) {
+	if len(scheduler.timers) == 0 {
+		return time.Time{}, false
+	}
+	return scheduler.timers[0].At, true
+}
+
+// PopDue removes and returns every timer whose deadline is not after now
+func (scheduler *Scheduler) PopDue(now time.Time) []Timer {
+	due := make([]Timer, 0)
+	for len(scheduler.timers) > 0 && !scheduler.timers[0].At.After(now) {
+		timer := heap.Pop(&scheduler.timers).(*Timer)
+		delete(scheduler.byChannel, timer.ChannelId)
+		due = append(due, *timer)
+	}
+	return due
+}
+
+// ResetWakeup makes the timer fire at the next deadline of the scheduler
+func ResetWakeup(wakeup *time.Timer, scheduler *Scheduler) {
+	if !wakeup.Stop() {
+		select {
+		case <-wakeup.C:
+		default:
+		}
+	}
+	if deadline, ok := scheduler.NextDeadline(); ok {
+		wakeup.Reset(time.Until(deadline))
+	}
+}
@@ -0,0 +1,138 @@
+package game
+
+import (
+	"fmt"
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/model"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestSchedulerOrdersByDeadline(t *testing.T) {
+	scheduler := NewScheduler()
+	start := time.Now()
+	scheduler.Schedule("c", DealTimer, start.Add(3*time.Second))
+	scheduler.Schedule("a", DealTimer, start.Add(1*time.Second))
+	scheduler.Schedule("b", ArbitrationTimer, start.Add(2*time.Second))
+
+	deadline, ok := scheduler.NextDeadline()
+	if !ok || !deadline.Equal(start.Add(time.Second)) {
+		t.Fatalf("next deadline should be the earliest one, got %v", deadline)
+	}
+	due := scheduler.PopDue(start.Add(2 * time.Second))
+	if len(due) != 2 || due[0].ChannelId != "a" || due[1].ChannelId != "b" || due[1].Kind != ArbitrationTimer {
+		t.Fatalf("unexpected due timers %+v", due)
+	}
+	if scheduler.Len() != 1 {
+		t.Fatalf("one timer should be left, got %d", scheduler.Len())
+	}
+}
+
+func TestSchedulerKeepsOneTimerPerChannel(t *testing.T) {
+	scheduler := NewScheduler()
+	start := time.Now()
+	scheduler.Schedule("a", DealTimer, start.Add(time.Second))
+	scheduler.Schedule("a", ArbitrationTimer, start.Add(5*time.Second))
+	if scheduler.Len() != 1 {
+		t.Fatalf("rescheduling should replace the timer, got %d timers", scheduler.Len())
+	}
+	if len(scheduler.PopDue(start.Add(2*time.Second))) != 0 {
+		t.Fatalf("replaced timer should not be due")
+	}
+	due := scheduler.PopDue(start.Add(5 * time.Second))
+	if len(due) != 1 || due[0].Kind != ArbitrationTimer {
+		t.Fatalf("unexpected due timers %+v", due)
+	}
+
+	scheduler.Schedule("a", DealTimer, start)
+	scheduler.Schedule("b", DealTimer, start)
+	scheduler.Cancel("a")
+	scheduler.Cancel("unknown")
+	due = scheduler.PopDue(start)
+	if len(due) != 1 || due[0].ChannelId != "b" {
+		t.Fatalf("cancelled timer should not be due, got %+v", due)
+	}
+}
+
+func TestRouterGoroutinesStayBounded(t *testing.T) {
+	const channels = 2000
+	context := env.GetContext()
+	context.Asset = common.Asset{
+		Cards: []common.Card{
+			{Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 1}}},
+			{Type: common.Fruit, Elements: []common.CardElement{{Variant: 2, Number: 2}}},
+			{Type: common.Fruit, Elements: []common.CardElement{{Variant: 3, Number: 3}}},
+		},
+	}
+	context.GameRule.DealInterval = 200 * time.Millisecond
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	eventChannel := make(chan Event, 32)
+	messageChannel := make(chan Message, 32)
+	revealed := make(chan string, 1024)
+	go func() {
+		for message := range messageChannel {
+			if message.MessageType == CardRevealed {
+				select {
+				case revealed <- message.ChannelId:
+				default:
+				}
+			}
+		}
+	}()
+	router := NewRouter(func(messages chan Message) {
+		for message := range messages {
+			messageChannel <- message
+		}
+	})
+	router.IdleTimeout = 100 * time.Millisecond
+	router.ReapInterval = 50 * time.Millisecond
+	go router.Run(eventChannel)
+	baseline := runtime.NumGoroutine()
+
+	player := model.User{Id: "player"}
+	for i := 0; i < channels; i++ {
+		reply := ReplyContext{ChannelId: fmt.Sprintf("channel-%d", i)}
+		eventChannel <- Event{EventType: Initiate, ReplyContext: reply, Param: Classic}
+		eventChannel <- Event{EventType: Join, ReplyContext: reply, Param: player}
+		eventChannel <- Event{EventType: Start, ReplyContext: reply}
+	}
+
+	// let every game deal several cards, pausing and continuing some of them,
+	// there should never be more than the game and its messages for each channel
+	deadline := time.After(10 * time.Second)
+	for count := 0; count < channels*3; count++ {
+		select {
+		case <-revealed:
+		case <-deadline:
+			t.Fatalf("only %d cards revealed", count)
+		}
+		if count%100 == 0 {
+			reply := ReplyContext{ChannelId: fmt.Sprintf("channel-%d", count%channels)}
+			eventChannel <- Event{EventType: RingTheBell, ReplyContext: reply, Param: Ring{Player: player, ReceivedAt: time.Now()}}
+			eventChannel <- Event{EventType: Continue, ReplyContext: reply}
+		}
+		if current := runtime.NumGoroutine(); current > baseline+2*channels+5 {
+			t.Fatalf("goroutines grew from %d to %d", baseline, current)
+		}
+	}
+
+	// stopped games are reaped once idle
+	for i := 0; i < channels; i++ {
+		eventChannel <- Event{EventType: Terminate, ReplyContext: ReplyContext{ChannelId: fmt.Sprintf("channel-%d", i)}}
+	}
+	deadline = time.After(5 * time.Second)
+	for runtime.NumGoroutine() > baseline+5 {
+		select {
+		case <-deadline:
+			t.Fatalf("goroutines grew from %d to %d", baseline, runtime.NumGoroutine())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package game
+
+import (
+	"halligalli/model"
+	"sort"
+)
+
+type PlayerScore struct {
+	Player    model.User
+	Score     int
+	Wins      int
+	FakeRings int
+}
+
+func (game *Game) ScoreOf(player model.User) *PlayerScore {
+	if game.Scores == nil {
+		game.Scores = make(map[string]*PlayerScore)
+	}
+	score := game.Scores[player.Id]
+	if score == nil {
+		score = &PlayerScore{Player: player}
+		game.Scores[player.Id] = score
+	}
+	return score
+}
+
+func (game *Game) AddWin(player model.User) *PlayerScore {
+	score := game.ScoreOf(player)
+	score.Score += game.Rule.WinReward
+	score.Wins += 1
+	return score
+}
+
+func (game *Game) AddFakeRing(player model.User) *PlayerScore {
+	score := game.ScoreOf(player)
+	score.Score -= game.Rule.FakeRingPenalty
+	score.FakeRings += 1
+	return score
+}
+
+// GetStandings returns scores ordered from the highest to the lowest
+func (game *Game) GetStandings() []PlayerScore {
+	standings := make([]PlayerScore, 0, len(game.Scores))
+	for _, score := range game.Scores {
+		standings = append(standings, *score)
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].Score != standings[j].Score {
+			return standings[i].Score > standings[j].Score
+		}
+		if standings[i].Wins != standings[j].Wins {
+			return standings[i].Wins > standings[j].Wins
+		}
+		return standings[i].Player.Id < standings[j].Player.Id
+	})
+	return standings
+}
+
+func (game *Game) ResetScores() {
+	game.Scores = make(map[string]*PlayerScore)
+}
@@ -0,0 +1,58 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"testing"
+)
+
+func TestScoresAccumulate(t *testing.T) {
+	game := &Game{Rule: common.Rule{WinReward: 10, FakeRingPenalty: 3}}
+	game.AddWin(alice)
+	game.AddWin(alice)
+	if score := game.AddFakeRing(alice); score.Score != 17 || score.Wins != 2 || score.FakeRings != 1 {
+		t.Fatalf("wins and fake rings should add up, got %+v", score)
+	}
+	if score := game.AddFakeRing(bob); score.Score != -3 || score.Player.Id != "bob" {
+		t.Fatalf("score can go below zero, got %+v", score)
+	}
+	if game.ScoreOf(alice) != game.Scores["alice"] || len(game.Scores) != 2 {
+		t.Fatalf("each player should have a single score")
+	}
+
+	game.ResetScores()
+	if len(game.GetStandings()) != 0 || game.ScoreOf(alice).Score != 0 {
+		t.Fatalf("scores should be reset")
+	}
+}
+
+func TestStandingsAreSorted(t *testing.T) {
+	game := &Game{Rule: common.Rule{WinReward: 10, FakeRingPenalty: 10}}
+	// carol and bob are tied on score, carol has more wins
+	game.AddWin(carol)
+	game.AddWin(carol)
+	game.AddFakeRing(carol)
+	game.AddWin(bob)
+	game.AddWin(alice)
+	game.AddWin(alice)
+	// dave and erin are tied on score and wins, they are ordered by id
+	erin := model.User{Id: "erin"}
+	dave := model.User{Id: "dave"}
+	game.AddFakeRing(erin)
+	game.AddFakeRing(dave)
+
+	standings := game.GetStandings()
+	expected := []string{"alice", "carol", "bob", "dave", "erin"}
+	if len(standings) != len(expected) {
+		t.Fatalf("expected %d players, got %+v", len(expected), standings)
+	}
+	for index, id := range expected {
+		if standings[index].Player.Id != id {
+			t.Fatalf("expected %v, got %+v", expected, standings)
+		}
+	}
+	standings[0].Score = 100
+	if game.Scores["alice"].Score != 20 {
+		t.Fatalf("standings should be copies of the scores")
+	}
+}
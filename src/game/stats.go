@@ -0,0 +1,89 @@
+package game
+
+import (
+	"halligalli/model"
+	"halligalli/rules"
+	"halligalli/storage"
+	"sort"
+	"time"
+)
+
+type PlayerStats struct {
+	Player    model.User
+	Reactions int
+	Total     time.Duration
+	Best      time.Duration
+}
+
+func (stats PlayerStats) Average() time.Duration {
+	if stats.Reactions == 0 {
+		return 0
+	}
+	return stats.Total / time.Duration(stats.Reactions)
+}
+
+// GetTriggerTime returns when the card that made the bell condition true was revealed
+func (game *Game) GetTriggerTime() (time.Time, bool) {
+	trigger := -1
+	for end := len(game.RevealedCards); end > 0; end-- {
+		window := rules.Window(game.RevealedCards[:end], game.Rule)
+		if !rules.Check(window, game.Rule).Ring {
+			break
+		}
+		trigger = end - 1
+	}
+	if trigger < 0 || trigger >= len(game.RevealedAt) {
+		return time.Time{}, false
+	}
+	return game.RevealedAt[trigger], true
+}
+
+// RecordReaction returns the reaction time of the ring, negative if it cannot be measured.
+// Both the reveal and the ring are taken on the local clock, the ring when it was received
+func (game *Game) RecordReaction(ring Ring) time.Duration {
+	triggerTime, ok := game.GetTriggerTime()
+	if !ok || ring.ReceivedAt.IsZero() {
+		return -1
+	}
+	reaction := ring.ReceivedAt.Sub(triggerTime)
+	if reaction < 0 {
+		return -1
+	}
+
+	if game.Stats == nil {
+		game.Stats = make(map[string]*PlayerStats)
+	}
+	stats := game.Stats[ring.Player.Id]
+	if stats == nil {
+		stats = &PlayerStats{Player: ring.Player}
+		game.Stats[ring.Player.Id] = stats
+	}
+	stats.Reactions += 1
+	stats.Total += reaction
+	if stats.Reactions == 1 || reaction < stats.Best {
+		stats.Best = reaction
+	}
+	UpdateProfile(ring.Player, func(profile *storage.PlayerProfile) {
+		profile.Reactions += 1
+		profile.ReactionTotal += reaction
+		if profile.Reactions == 1 || reaction < profile.ReactionBest {
+			profile.ReactionBest = reaction
+		}
+	})
+	return reaction
+}
+
+// GetStats returns the statistics ordered by personal best
+func (game *Game) GetStats() []PlayerStats {
+	result := make([]PlayerStats, 0, len(game.Stats))
+	for _, stats := range game.Stats {
+		result = append(result, *stats)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Best != result[j].Best {
+			return result[i].Best < result[j].Best
+		}
+		return result[i].Player.Id < result[j].Player.Id
+	})
+	return result
+}
@@ -0,0 +1,77 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"testing"
+	"time"
+)
+
+func fruitCard(variant int, number int) common.Card {
+	return common.Card{Type: common.Fruit, Elements: []common.CardElement{{Variant: variant, Number: number}}}
+}
+
+func revealedGame(start time.Time, cards ...common.Card) *Game {
+	game := &Game{Rule: common.Rule{ValidCardNumber: 3, FruitNumberToWin: 5}}
+	for index, card := range cards {
+		game.RevealedCards = append(game.RevealedCards, card)
+		game.RevealedAt = append(game.RevealedAt, start.Add(time.Duration(index)*time.Second))
+	}
+	return game
+}
+
+func TestGetTriggerTime(t *testing.T) {
+	start := time.Now()
+	animal := common.Card{Type: common.Animal}
+	tests := []struct {
+		name    string
+		cards   []common.Card
+		trigger int
+	}{
+		{name: "no card", trigger: -1},
+		{name: "no bell", cards: []common.Card{fruitCard(0, 1), fruitCard(0, 2)}, trigger: -1},
+		{name: "last card completes the fruits", cards: []common.Card{fruitCard(0, 2), fruitCard(1, 1), fruitCard(0, 3)}, trigger: 2},
+		{name: "animal still in the window", cards: []common.Card{fruitCard(0, 1), animal, fruitCard(1, 1), fruitCard(1, 2)}, trigger: 1},
+		{name: "fruits still adding up", cards: []common.Card{fruitCard(0, 5), fruitCard(1, 1)}, trigger: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			triggerTime, ok := revealedGame(start, test.cards...).GetTriggerTime()
+			if test.trigger < 0 {
+				if ok {
+					t.Fatalf("no card should trigger the bell, got %v", triggerTime)
+				}
+				return
+			}
+			expected := start.Add(time.Duration(test.trigger) * time.Second)
+			if !ok || !triggerTime.Equal(expected) {
+				t.Fatalf("bell should be triggered at card %d, got %v %t", test.trigger, triggerTime, ok)
+			}
+		})
+	}
+}
+
+func TestRecordReaction(t *testing.T) {
+	start := time.Now()
+	game := revealedGame(start, fruitCard(0, 2), fruitCard(0, 3))
+	alice := model.User{Id: "alice"}
+
+	if reaction := game.RecordReaction(Ring{Player: alice, ReceivedAt: start.Add(1300 * time.Millisecond)}); reaction != 300*time.Millisecond {
+		t.Fatalf("reaction should be measured from the trigger card, got %v", reaction)
+	}
+	game.RecordReaction(Ring{Player: alice, ReceivedAt: start.Add(1100 * time.Millisecond)})
+	if reaction := game.RecordReaction(Ring{Player: alice, ReceivedAt: start.Add(500 * time.Millisecond)}); reaction >= 0 {
+		t.Fatalf("ring received before the trigger card cannot be measured, got %v", reaction)
+	}
+	if reaction := game.RecordReaction(Ring{Player: alice}); reaction >= 0 {
+		t.Fatalf("ring without receive time cannot be measured, got %v", reaction)
+	}
+
+	stats := game.Stats["alice"]
+	if stats.Reactions != 2 || stats.Best != 100*time.Millisecond || stats.Average() != 200*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if reaction := revealedGame(start, fruitCard(0, 1)).RecordReaction(Ring{Player: alice, ReceivedAt: start}); reaction >= 0 {
+		t.Fatalf("reaction without bell cannot be measured, got %v", reaction)
+	}
+}
@@ -0,0 +1,147 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"math/rand"
+	"time"
+)
+
+type Mode = int
+
+const (
+	// Classic reveals cards from one shared deck forever
+	Classic Mode = iota
+	// Tabletop deals the deck to the players and eliminates those running out of cards
+	Tabletop
+)
+
+const MinTabletopPlayers = 2
+
+type HandStatus struct {
+	Player model.User
+	Cards  int
+}
+
+// DealHands splits the shuffled deck among the players in turn order
+func (game *Game) DealHands(players []model.User) {
+	game.ShuffleDeck()
+	game.Players = make([]model.User, len(players))
+	copy(game.Players, players)
+	game.Hands = make(map[string][]common.Card)
+	for _, player := range game.Players {
+		game.Hands[player.Id] = make([]common.Card, 0)
+	}
+	for index, card := range game.Deck {
+		player := game.Players[index%len(game.Players)]
+		game.Hands[player.Id] = append(game.Hands[player.Id], card)
+	}
+	game.Turn = 0
+	game.NewRound()
+}
+
+func (game *Game) IsPlayer(player model.User) bool {
+	_, ok := game.Hands[player.Id]
+	return ok
+}
+
+// RevealFromHand reveals the top card of the current player, players found
+// with an empty hand on their turn are eliminated and returned
+func (game *Game) RevealFromHand() (common.Card, bool, []model.User) {
+	eliminated := make([]model.User, 0)
+	for len(game.Players) > 1 {
+		player := game.Players[game.Turn]
+		hand := game.Hands[player.Id]
+		if len(hand) == 0 {
+			eliminated = append(eliminated, player)
+			game.Eliminate(player)
+			continue
+		}
+		card := hand[0]
+		game.Hands[player.Id] = hand[1:]
+		game.RevealedCards = append(game.RevealedCards, card)
+		game.RevealedAt = append(game.RevealedAt, time.Now())
+		game.Turn = (game.Turn + 1) % len(game.Players)
+		return card, true, eliminated
+	}
+	return common.Card{}, false, eliminated
+}
+
+func (game *Game) Eliminate(player model.User) {
+	for index, current := range game.Players {
+		if current.Id != player.Id {
+			continue
+		}
+		game.Players = append(game.Players[:index], game.Players[index+1:]...)
+		if index < game.Turn {
+			game.Turn -= 1
+		}
+		if game.Turn >= len(game.Players) {
+			game.Turn = 0
+		}
+		break
+	}
+	delete(game.Hands, player.Id)
+}
+
+// CollectTable gives the revealed cards to the winner, who starts the next round
+func (game *Game) CollectTable(winner model.User) {
+	if !game.IsPlayer(winner) {
+		return
+	}
+	cards := make([]common.Card, len(game.RevealedCards))
+	copy(cards, game.RevealedCards)
+	rand.Shuffle(len(cards), func(i, j int) {
+		cards[i], cards[j] = cards[j], cards[i]
+	})
+	game.Hands[winner.Id] = append(game.Hands[winner.Id], cards...)
+	for index, player := range game.Players {
+		if player.Id == winner.Id {
+			game.Turn = index
+		}
+	}
+}
+
+// PayPenalty makes the player give one card to every other player,
+// returns true if the player is eliminated for not being able to pay
+func (game *Game) PayPenalty(player model.User) bool {
+	if !game.IsPlayer(player) {
+		return false
+	}
+	for _, other := range game.Players {
+		if other.Id == player.Id {
+			continue
+		}
+		hand := game.Hands[player.Id]
+		if len(hand) == 0 {
+			game.Eliminate(player)
+			return true
+		}
+		game.Hands[other.Id] = append(game.Hands[other.Id], hand[0])
+		game.Hands[player.Id] = hand[1:]
+	}
+	if len(game.Hands[player.Id]) == 0 {
+		game.Eliminate(player)
+		return true
+	}
+	return false
+}
+
+func (game *Game) GetHandStatus() []HandStatus {
+	result := make([]HandStatus, len(game.Players))
+	for index, player := range game.Players {
+		result[index] = HandStatus{
+			Player: player,
+			Cards:  len(game.Hands[player.Id]),
+		}
+	}
+	return result
+}
+
+// GetWinner returns the last player standing
+func (game *Game) GetWinner() (model.User, bool) {
+	if len(game.Players) == 1 {
+		return game.Players[0], true
+	}
+	return model.User{}, false
+}
@@ -0,0 +1,134 @@
+package game
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"testing"
+)
+
+var (
+	alice = model.User{Id: "alice"}
+	bob   = model.User{Id: "bob"}
+	carol = model.User{Id: "carol"}
+)
+
+func handSizes(game *Game) []int {
+	sizes := make([]int, len(game.Players))
+	for index, player := range game.Players {
+		sizes[index] = len(game.Hands[player.Id])
+	}
+	return sizes
+}
+
+func tabletopGame(hands ...int) *Game {
+	game := &Game{Hands: make(map[string][]common.Card)}
+	for index, player := range []model.User{alice, bob, carol}[:len(hands)] {
+		game.Players = append(game.Players, player)
+		game.Hands[player.Id] = make([]common.Card, 0)
+		for i := 0; i < hands[index]; i++ {
+			game.Hands[player.Id] = append(game.Hands[player.Id], fruitCard(index, i+1))
+		}
+	}
+	return game
+}
+
+func TestDealHandsOfUnevenDeck(t *testing.T) {
+	game := &Game{Turn: 2}
+	for i := 0; i < 7; i++ {
+		game.Deck = append(game.Deck, fruitCard(0, i+1))
+	}
+	players := []model.User{alice, bob, carol}
+	game.DealHands(players)
+	if sizes := handSizes(game); sizes[0] != 3 || sizes[1] != 2 || sizes[2] != 2 {
+		t.Fatalf("first players should get the extra cards, got %v", sizes)
+	}
+	seen := make(map[int]bool)
+	for _, hand := range game.Hands {
+		for _, card := range hand {
+			seen[card.Elements[0].Number] = true
+		}
+	}
+	if len(seen) != 7 || game.Turn != 0 || game.Round != 1 {
+		t.Fatalf("every card should be dealt once and the first player starts, got %v turn %d", seen, game.Turn)
+	}
+	players[0] = model.User{Id: "mallory"}
+	if game.Players[0].Id != "alice" {
+		t.Fatalf("players should be copied")
+	}
+}
+
+func TestEliminatePlayerWhoseTurnItIs(t *testing.T) {
+	game := tabletopGame(1, 1, 1)
+	game.Turn = 1
+	game.Eliminate(bob)
+	if game.Players[game.Turn].Id != "carol" || game.IsPlayer(bob) {
+		t.Fatalf("next player should take the turn, got %+v turn %d", game.Players, game.Turn)
+	}
+	game.Eliminate(carol)
+	if game.Turn != 0 {
+		t.Fatalf("turn should wrap to the first player, got %d", game.Turn)
+	}
+
+	game = tabletopGame(1, 1, 1)
+	game.Turn = 2
+	game.Eliminate(alice)
+	if game.Players[game.Turn].Id != "carol" {
+		t.Fatalf("turn should stay with carol after an earlier player leaves, got turn %d", game.Turn)
+	}
+}
+
+func TestRevealFromHandSkipsEmptyHand(t *testing.T) {
+	game := tabletopGame(1, 0, 2)
+	game.Turn = 1
+	card, ok, eliminated := game.RevealFromHand()
+	if !ok || len(eliminated) != 1 || eliminated[0].Id != "bob" {
+		t.Fatalf("bob should be eliminated on the turn of bob, got %+v %t %+v", card, ok, eliminated)
+	}
+	if card.Elements[0].Variant != 2 || len(game.RevealedCards) != 1 || len(game.Hands["carol"]) != 1 {
+		t.Fatalf("carol should reveal in place of bob, got %+v", card)
+	}
+	if game.Players[game.Turn].Id != "alice" {
+		t.Fatalf("turn should pass to alice, got %d", game.Turn)
+	}
+}
+
+func TestPayPenaltyWithFewerCardsThanOpponents(t *testing.T) {
+	game := tabletopGame(1, 2, 3)
+	if !game.PayPenalty(alice) {
+		t.Fatalf("alice cannot pay every opponent and should be eliminated")
+	}
+	if game.IsPlayer(alice) || len(game.Hands["bob"]) != 3 || len(game.Hands["carol"]) != 3 {
+		t.Fatalf("the only card should go to the first opponent, got %v", handSizes(game))
+	}
+
+	game = tabletopGame(3, 2, 2)
+	if game.PayPenalty(alice) || len(game.Hands["alice"]) != 1 || len(game.Hands["bob"]) != 3 || len(game.Hands["carol"]) != 3 {
+		t.Fatalf("alice should pay one card to each opponent, got %v", handSizes(game))
+	}
+	if game.PayPenalty(model.User{Id: "viewer"}) {
+		t.Fatalf("viewer should not pay")
+	}
+}
+
+func TestLastPlayerStanding(t *testing.T) {
+	game := tabletopGame(1, 1)
+	if _, ok := game.GetWinner(); ok {
+		t.Fatalf("nobody wins while two players are left")
+	}
+	game.RevealFromHand()
+	game.RevealFromHand()
+	game.CollectTable(bob)
+	if len(game.Hands["bob"]) != 2 || game.Players[game.Turn].Id != "bob" {
+		t.Fatalf("bob should collect the table and start, got %v turn %d", handSizes(game), game.Turn)
+	}
+
+	// alice runs out of cards on the next turn, leaving nobody to reveal against
+	game.Turn = 0
+	_, ok, eliminated := game.RevealFromHand()
+	if ok || len(eliminated) != 1 || eliminated[0].Id != "alice" {
+		t.Fatalf("alice should be eliminated without a card revealed, got %t %+v", ok, eliminated)
+	}
+	if winner, ok := game.GetWinner(); !ok || winner.Id != "bob" {
+		t.Fatalf("bob should be the last one standing, got %+v %t", winner, ok)
+	}
+}
@@ -0,0 +1,223 @@
+package locale
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/model"
+	"halligalli/render"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	DefaultDir = "assets/locales"
+	Chinese    = "zh"
+	English    = "en"
+)
+
+// Shipped are the locales with a file in DefaultDir
+var Shipped = []string{Chinese, English}
+
+// DefaultCatalog is loaded at startup, it is nil until then
+var DefaultCatalog *Catalog
+
+// File is the content of a locale file, fruits and animals without a name here are named as in the asset file
+type File struct {
+	Fruits  map[int]string `yaml:"fruits"`
+	Animals map[int]string `yaml:"animals"`
+	// Decks describe the deck profiles by name
+	Decks   map[string]string `yaml:"decks"`
+	Buttons map[string]string `yaml:"buttons"`
+	// Messages are Go templates keyed by message
+	Messages map[string]string `yaml:"messages"`
+}
+
+type catalogLocale struct {
+	file      File
+	templates *template.Template
+}
+
+// Catalog holds the messages of every locale, messages missing from a locale are taken from Fallback
+type Catalog struct {
+	Fallback string
+	locales  map[string]*catalogLocale
+}
+
+// LoadCatalog reads every yaml file of the directory, the name of the file being its locale
+func LoadCatalog(dir string) (*Catalog, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no locale file in %s", dir)
+	}
+	catalog := &Catalog{
+		Fallback: Chinese,
+		locales:  make(map[string]*catalogLocale),
+	}
+	var errs []error
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		if err = catalog.loadFile(name, path); err != nil {
+			errs = append(errs, fmt.Errorf("locale %s: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return catalog, nil
+}
+
+func (catalog *Catalog) loadFile(name string, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file File
+	if err = yaml.Unmarshal(content, &file); err != nil {
+		return err
+	}
+	return catalog.Add(name, file)
+}
+
+// Add parses the templates of the locale, replacing the locale if it was already added
+func (catalog *Catalog) Add(name string, file File) error {
+	entry := &catalogLocale{file: file}
+	entry.templates = template.New(name).Option("missingkey=error").Funcs(entry.funcs())
+	for key, text := range file.Messages {
+		if _, err := entry.templates.New(key).Parse(text); err != nil {
+			return err
+		}
+	}
+	catalog.locales[name] = entry
+	return nil
+}
+
+func (catalog *Catalog) Has(name string) bool {
+	_, ok := catalog.locales[name]
+	return ok
+}
+
+func (catalog *Catalog) Locales() []string {
+	names := make([]string, 0, len(catalog.locales))
+	for name := range catalog.locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HasMessage reports whether the locale itself has the message, without falling back
+func (catalog *Catalog) HasMessage(name string, key string) bool {
+	entry, ok := catalog.locales[name]
+	return ok && entry.templates.Lookup(key) != nil
+}
+
+// Render executes the template of the key in the locale, or in the fallback locale if the locale lacks it
+func (catalog *Catalog) Render(name string, key string, data any) (string, error) {
+	for _, candidate := range []string{name, catalog.Fallback} {
+		entry, ok := catalog.locales[candidate]
+		if !ok || entry.templates.Lookup(key) == nil {
+			continue
+		}
+		var builder strings.Builder
+		if err := entry.templates.ExecuteTemplate(&builder, key, data); err != nil {
+			return "", err
+		}
+		return builder.String(), nil
+	}
+	return "", fmt.Errorf("no message %q in locale %s or %s", key, name, catalog.Fallback)
+}
+
+// Button returns the label of the button of the command, false if the locale has none
+func (catalog *Catalog) Button(name string, command string) (string, bool) {
+	for _, candidate := range []string{name, catalog.Fallback} {
+		if entry, ok := catalog.locales[candidate]; ok {
+			if label, ok := entry.file.Buttons[command]; ok {
+				return label, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (entry *catalogLocale) name(cardType common.CardType, variant int) string {
+	names := entry.file.Fruits
+	if cardType == common.Animal {
+		names = entry.file.Animals
+	}
+	if name, ok := names[variant]; ok {
+		return name
+	}
+	return render.AssetName(cardType, variant)
+}
+
+func (entry *catalogLocale) funcs() template.FuncMap {
+	return template.FuncMap{
+		"mention": func(user model.User) string {
+			return fmt.Sprintf("<@!%s>", user.Id)
+		},
+		"seconds": func(duration time.Duration) string {
+			return fmt.Sprintf("%.2f", duration.Seconds())
+		},
+		"add": func(a int, b int) int {
+			return a + b
+		},
+		"neg": func(a int) int {
+			return -a
+		},
+		"percent": func(ratio float64) float64 {
+			return ratio * 100
+		},
+		"fruit": func(variant int) string {
+			return entry.name(common.Fruit, variant)
+		},
+		"animal": func(variant int) string {
+			return entry.name(common.Animal, variant)
+		},
+		"deck": func(name string) string {
+			return entry.file.Decks[name]
+		},
+		"card": func(card common.Card) string {
+			return render.CardText(card, entry.name)
+		},
+		"board": func(cards []common.Card) string {
+			return render.BoardText(cards, entry.name)
+		},
+	}
+}
+
+// IsKnown reports whether messages can be written in the locale
+func IsKnown(name string) bool {
+	if DefaultCatalog != nil {
+		return DefaultCatalog.Has(name)
+	}
+	for _, shipped := range Shipped {
+		if shipped == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve picks the locale of the channel, then the one of its guild, then the default one
+func Resolve(channelLocale string, guildId string) string {
+	if channelLocale != "" {
+		return channelLocale
+	}
+	if store := env.GetContext().Store; store != nil && guildId != "" {
+		guild, ok, err := store.GetGuild(guildId)
+		if err == nil && ok && guild.Locale != "" {
+			return guild.Locale
+		}
+	}
+	return env.GetContext().Locale
+}
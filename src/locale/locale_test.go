@@ -0,0 +1,61 @@
+package locale
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"strings"
+	"testing"
+)
+
+func TestRenderFallsBackToFallbackLocale(t *testing.T) {
+	env.GetContext().Asset.Meta = common.AssetMeta{
+		Fruits: []common.AssetVariant{{Name: "草莓", Variant: 1, Emoji: "🍓"}},
+	}
+	catalog := &Catalog{Fallback: Chinese, locales: make(map[string]*catalogLocale)}
+	if err := catalog.Add(Chinese, File{
+		Buttons:  map[string]string{"start": "开始"},
+		Messages: map[string]string{"greet": "你好", "fruit": "{{fruit .}}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := catalog.Add(English, File{
+		Fruits:   map[int]string{1: "strawberry"},
+		Messages: map[string]string{"fruit": "{{fruit .}}", "broken": "{{.Missing}}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct{ locale, key, expected string }{
+		{English, "fruit", "strawberry"},
+		{Chinese, "fruit", "草莓"},
+		{English, "greet", "你好"},
+		{"fr", "greet", "你好"},
+	} {
+		text, err := catalog.Render(test.locale, test.key, 1)
+		if err != nil || text != test.expected {
+			t.Errorf("%s in %s should be %q, got %q, %v", test.key, test.locale, test.expected, text, err)
+		}
+	}
+	if _, err := catalog.Render(English, "unknown", nil); err == nil {
+		t.Errorf("unknown message should fail")
+	}
+	if _, err := catalog.Render(English, "broken", map[string]any{}); err == nil {
+		t.Errorf("missing keys should fail instead of writing <no value>")
+	}
+	if label, ok := catalog.Button(English, "start"); !ok || label != "开始" {
+		t.Errorf("button should fall back, got %q", label)
+	}
+}
+
+func TestLoadShippedCatalog(t *testing.T) {
+	if _, err := LoadCatalog(t.TempDir()); err == nil {
+		t.Fatalf("empty directory should fail")
+	}
+	catalog, err := LoadCatalog("../assets/locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(catalog.Locales(), ",") != "en,zh" {
+		t.Fatalf("shipped locales should be loaded, got %v", catalog.Locales())
+	}
+}
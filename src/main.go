@@ -1,18 +1,20 @@
 package main
 
 import (
-	"github.com/gorilla/websocket"
 	"halligalli/assets"
-	"halligalli/auth"
+	"halligalli/common"
+	"halligalli/config"
 	"halligalli/env"
 	"halligalli/game"
-	"halligalli/model"
+	"halligalli/locale"
+	"halligalli/render"
 	"halligalli/server"
+	"halligalli/storage"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
-	"time"
+	"path/filepath"
 )
 
 func main() {
@@ -20,120 +22,61 @@ func main() {
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	err := assets.LoadAssets()
+	conf, err := config.Load(os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Panicln("ERROR loading assets", err)
+		log.Fatalln("ERROR loading config", err)
 	}
+	conf.Apply()
 
-	err = auth.LoadTokenFromConfig()
+	err = assets.LoadAssets(conf.AssetPath)
 	if err != nil {
-		log.Panicln("ERROR load token from config", err)
+		log.Panicln("ERROR loading assets", err)
+	}
+	for _, profile := range game.DeckProfiles {
+		slog.Info(game.CheckDeck(profile.Name, profile.Build(env.GetContext().Asset.Cards), env.GetContext().GameRule).String())
 	}
 
-	err = server.ConnectToWebsocketServer()
+	catalog, err := locale.LoadCatalog(conf.LocalePath)
 	if err != nil {
-		log.Panicln("ERROR connect to websocket server", err)
+		log.Panicln("ERROR loading locales", err)
 	}
-	defer func(conn *websocket.Conn) {
-		if conn == nil {
-			return
-		}
-		if err := conn.Close(); err != nil {
-			log.Panicln("close:", err)
-		}
-	}(env.GetContext().Connection)
+	if !catalog.Has(conf.Locale) {
+		log.Panicf("ERROR no locale %s in %s, found %v", conf.Locale, conf.LocalePath, catalog.Locales())
+	}
+	catalog.Fallback = conf.Locale
+	locale.DefaultCatalog = catalog
 
-	heartbeatTicker := time.NewTicker(time.Duration(model.DefaultHeartbeatIntervalMillis) * time.Millisecond)
-	defer func() {
-		if heartbeatTicker != nil {
-			heartbeatTicker.Stop()
+	store, err := storage.NewFileStore(conf.StoragePath)
+	if err != nil {
+		log.Panicln("ERROR opening storage", err)
+	}
+	env.GetContext().Store = store
+	render.DefaultLoader = render.NewCardRenderer(filepath.Join(conf.StoragePath, render.CardCacheDirName))
+	// cards are drawn before the first game instead of while its cards are being revealed
+	go func() {
+		if err := render.Prefetch(env.GetContext().Asset.Cards, render.DefaultLoader); err != nil {
+			slog.Error("prefetching cards", "err", err)
 		}
 	}()
 
-	lastMessageId := model.DefaultLastMessageId
-
 	eventChannel := make(chan game.Event, 32)
-	messageChannel := make(chan game.Message, 32)
 
-	go game.MainLoop(eventChannel, messageChannel)
-	go server.HandleGameMessage(messageChannel)
+	// every game sends its messages on its own so that a slow channel does not hold back the others
+	go game.MainLoop(eventChannel, server.HandleGameMessage)
 
-	done := make(chan bool)
-	go func() {
-		defer close(done)
-		for {
-			_, message, err := env.GetContext().Connection.ReadMessage()
-			if err != nil {
-				log.Println("ERROR reading message:", err)
-				continue
-			}
-			log.Printf("receive: %s", message)
-			raw, err := model.GetOpType(message)
-			if err != nil {
-				log.Println("ERROR getting operation type:", err)
-				continue
-			}
-			if raw.MessageId != model.DefaultLastMessageId {
-				lastMessageId = raw.MessageId
-			}
-
-			switch raw.Op {
-			case model.Hello:
-				if heartbeatTicker, err = server.HandleHelloResponse(raw.Body); err != nil {
-					continue
-				}
-			case model.HeartbeatAck:
-				log.Printf("heartbeat acknowledged")
-			case model.Dispatch:
-				switch raw.Intent {
-				case model.Ready:
-					if err := server.HandleReadyResponse(raw.Body); err != nil {
-						log.Println("ERROR handle ready response", err)
-						continue
-					}
-				case model.MessageCreate:
-					if err := server.HandleMessageCreateResponse(raw.Body, eventChannel); err != nil {
-						log.Println("ERROR handle message", err)
-						continue
-					}
-				}
-			}
+	delivery := env.GetContext().Delivery
+	switch delivery.Mode {
+	case common.Webhook:
+		webhook, err := server.NewWebhookServer(delivery.Address, env.GetContext().Token.Secret, eventChannel)
+		if err != nil {
+			log.Panicln("ERROR starting webhook server", err)
 		}
-	}()
-
-	for {
-		select {
-		case <-done:
-			return
-		case _ = <-heartbeatTicker.C:
-			var heartbeatReq model.HeartbeatBody
-			if lastMessageId != model.DefaultLastMessageId {
-				heartbeatReq.LastMessageId = strconv.Itoa(lastMessageId)
-			}
-			request, err := model.BuildRequest(model.Heartbeat, heartbeatReq).GetString()
-			if err != nil {
-				log.Println("ERROR building request:", err)
-				continue
-			}
-			err = env.GetContext().Connection.WriteMessage(websocket.TextMessage, request)
-			if err != nil {
-				log.Println("ERROR sending message:", err)
-				continue
-			}
-			log.Printf("heartbeat, last message id: %d", lastMessageId)
-		case <-interrupt:
-			log.Println("interrupted by user event")
-			err := env.GetContext().Connection.WriteMessage(websocket.CloseMessage,
-				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			if err != nil {
-				log.Println("ERROR sending message:", err)
-				return
-			}
-			select {
-			case <-done:
-			case <-time.After(time.Second):
-			}
-			return
+		if err = webhook.Run(interrupt); err != nil {
+			log.Panicln("ERROR running webhook server", err)
 		}
+	default:
+		// games keep running in the main loop while the supervisor reconnects
+		supervisor := server.NewSupervisor(eventChannel)
+		supervisor.Run(interrupt)
 	}
 }
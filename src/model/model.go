@@ -20,12 +20,22 @@ const (
 	InvalidSession
 	Hello
 	HeartbeatAck
+	// HttpCallback acknowledges an event received by webhook
 	HttpCallback
+	// CallbackValidation asks the webhook to prove it owns the bot secret
+	CallbackValidation
 )
 
 const (
-	Ready         IntentType = "READY"
-	MessageCreate IntentType = "MESSAGE_CREATE"
+	Ready                 IntentType = "READY"
+	Resumed               IntentType = "RESUMED"
+	MessageCreate         IntentType = "MESSAGE_CREATE"
+	AtMessageCreate       IntentType = "AT_MESSAGE_CREATE"
+	GuildCreate           IntentType = "GUILD_CREATE"
+	GuildDelete           IntentType = "GUILD_DELETE"
+	MessageReactionAdd    IntentType = "MESSAGE_REACTION_ADD"
+	MessageReactionRemove IntentType = "MESSAGE_REACTION_REMOVE"
+	InteractionCreate     IntentType = "INTERACTION_CREATE"
 )
 
 type MessageModel struct {
@@ -42,11 +52,34 @@ type IdentifyBody struct {
 	Properties map[string]string `json:"properties"`
 }
 
-const Intents int32 = 1 + (1 << 1) + (1 << 9) + (1 << 10) + (1 << 12)
+type ResumeBody struct {
+	Token     string `json:"token"`
+	SessionId string `json:"session_id"`
+	Seq       int    `json:"seq"`
+}
+
+const Intents int32 = 1 + (1 << 1) + (1 << 9) + (1 << 10) + (1 << 12) + (1 << 26)
+
+// IntentFlags names the events the bot can subscribe to when identifying
+var IntentFlags = map[string]int32{
+	"guilds":                  1 << 0,
+	"guild_members":           1 << 1,
+	"guild_messages":          1 << 9,
+	"guild_message_reactions": 1 << 10,
+	"direct_message":          1 << 12,
+	"interaction":             1 << 26,
+	"message_audit":           1 << 27,
+	"forums":                  1 << 28,
+	"audio_action":            1 << 29,
+	"public_guild_messages":   1 << 30,
+}
+
 const DefaultHeartbeatIntervalMillis int = 1000
 const DefaultLastMessageId int = 0
 
 type MessageModelRaw struct {
+	// Id identifies the event, a webhook event delivered again keeps it
+	Id        string          `json:"id"`
 	Op        OpType          `json:"op"`
 	MessageId int             `json:"s"`
 	Intent    IntentType      `json:"t"`
@@ -97,6 +130,33 @@ func ParseMessageCreateResponseBody(source json.RawMessage) (MessageCreateBody,
 	return body, nil
 }
 
+func ParseGuildBody(source json.RawMessage) (GuildBody, error) {
+	var body GuildBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return GuildBody{}, err
+	}
+	return body, nil
+}
+
+func ParseMessageReactionBody(source json.RawMessage) (MessageReactionBody, error) {
+	var body MessageReactionBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return MessageReactionBody{}, err
+	}
+	return body, nil
+}
+
+func ParseInteractionBody(source json.RawMessage) (InteractionBody, error) {
+	var body InteractionBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return InteractionBody{}, err
+	}
+	return body, nil
+}
+
 type HelloBody struct {
 	HeartbeatInterval int `json:"heartbeat_interval"`
 }
@@ -138,12 +198,177 @@ type MessageCreateBody struct {
 	Timestamp    string `json:"timestamp"`
 }
 
+type GuildBody struct {
+	Id          string `json:"id"`
+	Name        string `json:"name"`
+	OwnerId     string `json:"owner_id"`
+	MemberCount int    `json:"member_count"`
+	JoinedAt    string `json:"joined_at"`
+	OpUserId    string `json:"op_user_id"`
+}
+
+type ReactionTarget struct {
+	Id   string `json:"id"`
+	Type int    `json:"type"`
+}
+
+type Emoji struct {
+	Id   string `json:"id"`
+	Type int    `json:"type"`
+}
+
+type MessageReactionBody struct {
+	UserId    string         `json:"user_id"`
+	GuildId   string         `json:"guild_id"`
+	ChannelId string         `json:"channel_id"`
+	Target    ReactionTarget `json:"target"`
+	Emoji     Emoji          `json:"emoji"`
+}
+
+type InteractionResolved struct {
+	ButtonData string `json:"button_data"`
+	ButtonId   string `json:"button_id"`
+	UserId     string `json:"user_id"`
+	MessageId  string `json:"message_id"`
+}
+
+type InteractionData struct {
+	Type     int                 `json:"type"`
+	Resolved InteractionResolved `json:"resolved"`
+}
+
+type InteractionBody struct {
+	Id            string          `json:"id"`
+	ApplicationId string          `json:"application_id"`
+	Type          int             `json:"type"`
+	Data          InteractionData `json:"data"`
+	GuildId       string          `json:"guild_id"`
+	ChannelId     string          `json:"channel_id"`
+	Timestamp     string          `json:"timestamp"`
+}
+
 type GatewayBody struct {
 	Url string `json:"url"`
 }
 
 type MessageSendBody struct {
-	Content        string `json:"content"`
-	ReplyMessageId string `json:"msg_id"`
-	ImageUrl       string `json:"image"`
+	Content string `json:"content,omitempty"`
+	// MsgType is MarkdownMessage for a message written in Markdown, the only messages that can carry a Keyboard
+	MsgType        int       `json:"msg_type,omitempty"`
+	Markdown       *Markdown `json:"markdown,omitempty"`
+	ReplyMessageId string    `json:"msg_id,omitempty"`
+	ImageUrl       string    `json:"image,omitempty"`
+	Keyboard       *Keyboard `json:"keyboard,omitempty"`
+	// FileImage is uploaded as a file attachment instead of ImageUrl
+	FileImage []byte `json:"-"`
+}
+
+const MarkdownMessage = 2
+
+type Markdown struct {
+	Content string `json:"content"`
+}
+
+const (
+	// ButtonCallback buttons are reported by INTERACTION_CREATE events
+	ButtonCallback = 1
+	// ButtonEveryone lets every user of the channel press the button
+	ButtonEveryone = 2
+	ButtonGrey     = 0
+	ButtonBlue     = 1
+)
+
+type Keyboard struct {
+	Content KeyboardContent `json:"content"`
+}
+
+type KeyboardContent struct {
+	Rows []KeyboardRow `json:"rows"`
+}
+
+type KeyboardRow struct {
+	Buttons []Button `json:"buttons"`
+}
+
+type Button struct {
+	Id         string           `json:"id"`
+	RenderData ButtonRenderData `json:"render_data"`
+	Action     ButtonAction     `json:"action"`
+}
+
+type ButtonRenderData struct {
+	Label        string `json:"label"`
+	VisitedLabel string `json:"visited_label"`
+	Style        int    `json:"style"`
+}
+
+type ButtonAction struct {
+	Type          int              `json:"type"`
+	Permission    ButtonPermission `json:"permission"`
+	Data          string           `json:"data"`
+	UnsupportTips string           `json:"unsupport_tips"`
+}
+
+type ButtonPermission struct {
+	Type int `json:"type"`
+}
+
+const (
+	InteractionSucceeded = 0
+	InteractionFailed    = 1
+)
+
+type InteractionAckBody struct {
+	Code int `json:"code"`
+}
+
+// ErrorBody is returned by the OpenAPI along with a non 2xx status code
+type ErrorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	TraceId string `json:"trace_id"`
+}
+
+type MessageResponseBody struct {
+	Id        string `json:"id"`
+	ChannelId string `json:"channel_id"`
+	GuildId   string `json:"guild_id"`
+	Timestamp string `json:"timestamp"`
+}
+
+func ParseErrorBody(source []byte) (ErrorBody, error) {
+	var body ErrorBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return ErrorBody{}, err
+	}
+	return body, nil
+}
+
+func ParseMessageResponseBody(source []byte) (MessageResponseBody, error) {
+	var body MessageResponseBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return MessageResponseBody{}, err
+	}
+	return body, nil
+}
+
+type ValidationBody struct {
+	PlainToken string `json:"plain_token"`
+	EventTs    string `json:"event_ts"`
+}
+
+type ValidationResponseBody struct {
+	PlainToken string `json:"plain_token"`
+	Signature  string `json:"signature"`
+}
+
+func ParseValidationBody(source json.RawMessage) (ValidationBody, error) {
+	var body ValidationBody
+	err := json.Unmarshal(source, &body)
+	if err != nil {
+		return ValidationBody{}, err
+	}
+	return body, nil
 }
@@ -0,0 +1,143 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"halligalli/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+const (
+	// CardHeight is the height every card is scaled to on the board
+	CardHeight   = 240
+	BoardPadding = 16
+	CardGap      = 12
+	// HighlightWidth is the border drawn around the newest card
+	HighlightWidth = 4
+)
+
+var (
+	BoardBackground = color.RGBA{R: 0x2e, G: 0x6b, B: 0x3f, A: 0xff}
+	HighlightColor  = color.RGBA{R: 0xff, G: 0xd5, B: 0x4f, A: 0xff}
+)
+
+// ImageLoader provides the picture of a card
+type ImageLoader interface {
+	Load(card common.Card) (image.Image, error)
+}
+
+// DefaultLoader draws the cards so that boards do not depend on the image host
+var DefaultLoader ImageLoader = NewCardRenderer("")
+
+// Prefetch loads every card once, so that boards are later drawn from memory
+func Prefetch(cards []common.Card, loader ImageLoader) error {
+	var errs []error
+	loaded := make(map[string]bool)
+	for _, card := range cards {
+		key := CardKey(card)
+		if loaded[key] {
+			continue
+		}
+		loaded[key] = true
+		if _, err := loader.Load(card); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Board lays the cards out from left to right, the last one being the newest
+func Board(cards []common.Card, loader ImageLoader) (image.Image, error) {
+	if len(cards) == 0 {
+		return nil, errors.New("no card to render")
+	}
+	scaled := make([]image.Image, len(cards))
+	width := BoardPadding*2 + CardGap*(len(cards)-1)
+	for index, card := range cards {
+		source, err := loader.Load(card)
+		if err != nil {
+			return nil, err
+		}
+		scaled[index] = ScaleToHeight(source, CardHeight)
+		width += scaled[index].Bounds().Dx()
+	}
+
+	board := image.NewRGBA(image.Rect(0, 0, width, CardHeight+BoardPadding*2))
+	draw.Draw(board, board.Bounds(), image.NewUniform(BoardBackground), image.Point{}, draw.Src)
+	x := BoardPadding
+	for index, card := range scaled {
+		bounds := card.Bounds()
+		target := image.Rect(x, BoardPadding, x+bounds.Dx(), BoardPadding+bounds.Dy())
+		if index == len(scaled)-1 {
+			highlight := target.Inset(-HighlightWidth)
+			draw.Draw(board, highlight, image.NewUniform(HighlightColor), image.Point{}, draw.Src)
+		}
+		draw.Draw(board, target, card, bounds.Min, draw.Over)
+		x += bounds.Dx() + CardGap
+	}
+	return board, nil
+}
+
+// ScaleToHeight resizes the image keeping its aspect ratio, interpolating between the source pixels
+func ScaleToHeight(source image.Image, height int) image.Image {
+	bounds := source.Bounds()
+	if bounds.Dy() == height || bounds.Dy() == 0 {
+		return source
+	}
+	width := bounds.Dx() * height / bounds.Dy()
+	ratio := float64(bounds.Dy()) / float64(height)
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			scaled.SetRGBA(x, y, bilinear(source, (float64(x)+0.5)*ratio-0.5, (float64(y)+0.5)*ratio-0.5))
+		}
+	}
+	return scaled
+}
+
+// bilinear samples the source at a fractional position relative to its bounds
+func bilinear(source image.Image, x float64, y float64) color.RGBA {
+	bounds := source.Bounds()
+	clamp := func(value int, limit int) int {
+		return min(max(value, 0), limit-1)
+	}
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	var channels [4]float64
+	for _, corner := range [4]struct {
+		dx, dy int
+		weight float64
+	}{
+		{0, 0, (1 - fx) * (1 - fy)},
+		{1, 0, fx * (1 - fy)},
+		{0, 1, (1 - fx) * fy},
+		{1, 1, fx * fy},
+	} {
+		px := bounds.Min.X + clamp(x0+corner.dx, bounds.Dx())
+		py := bounds.Min.Y + clamp(y0+corner.dy, bounds.Dy())
+		// premultiplied channels keep transparent pixels from darkening the edges
+		r, g, b, a := source.At(px, py).RGBA()
+		channels[0] += float64(r) * corner.weight
+		channels[1] += float64(g) * corner.weight
+		channels[2] += float64(b) * corner.weight
+		channels[3] += float64(a) * corner.weight
+	}
+	return color.RGBA{
+		R: uint8(channels[0] / 257),
+		G: uint8(channels[1] / 257),
+		B: uint8(channels[2] / 257),
+		A: uint8(channels[3] / 257),
+	}
+}
+
+func EncodePNG(board image.Image) ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, board); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,89 @@
+package render
+
+import (
+	"bytes"
+	"errors"
+	"halligalli/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+)
+
+type colorLoader map[string]image.Image
+
+func (loader colorLoader) Load(card common.Card) (image.Image, error) {
+	source, ok := loader[card.Image]
+	if !ok {
+		return nil, errors.New("unknown card")
+	}
+	return source, nil
+}
+
+func solid(width int, height int, fill color.Color) image.Image {
+	source := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(source, source.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+	return source
+}
+
+func TestBoardLaysOutTheWindow(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	loader := colorLoader{
+		"red":  solid(100, 120, red),
+		"blue": solid(200, 480, blue),
+	}
+	cards := []common.Card{{Image: "red"}, {Image: "blue"}}
+	board, err := Board(cards, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// red is scaled up to 200x240 and blue down to 100x240
+	width := BoardPadding*2 + CardGap + 200 + 100
+	if board.Bounds().Dx() != width || board.Bounds().Dy() != CardHeight+BoardPadding*2 {
+		t.Fatalf("unexpected board size %v", board.Bounds())
+	}
+	samples := []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{BoardPadding + 100, BoardPadding + 120, red},
+		{BoardPadding + 200 + CardGap + 50, BoardPadding + 120, blue},
+		{BoardPadding + 200 + CardGap - HighlightWidth/2, BoardPadding + 120, HighlightColor},
+		{BoardPadding / 2, BoardPadding / 2, BoardBackground},
+	}
+	for _, sample := range samples {
+		if got := color.RGBAModel.Convert(board.At(sample.x, sample.y)); got != sample.expected {
+			t.Errorf("pixel (%d, %d) should be %v, got %v", sample.x, sample.y, sample.expected, got)
+		}
+	}
+
+	encoded, err := EncodePNG(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = png.Decode(bytes.NewReader(encoded)); err != nil {
+		t.Fatalf("board should be a valid png: %v", err)
+	}
+
+	if _, err = Board([]common.Card{{Image: "missing"}}, loader); err == nil {
+		t.Fatalf("missing card image should fail")
+	}
+}
+
+func TestPrefetchLoadsEachCardOnce(t *testing.T) {
+	renderer := NewCardRenderer("")
+	panda := common.Card{Type: common.Animal, Variant: 5}
+	cards := []common.Card{panda, panda, {Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 2}}}}
+	if err := Prefetch(cards, renderer); err != nil {
+		t.Fatal(err)
+	}
+	if len(renderer.images) != 2 {
+		t.Fatalf("every different card should be loaded once, got %d", len(renderer.images))
+	}
+	if err := Prefetch([]common.Card{{Image: "unknown"}}, colorLoader{}); err == nil {
+		t.Fatalf("card that cannot be loaded should be reported")
+	}
+}
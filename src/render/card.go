@@ -0,0 +1,220 @@
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"halligalli/common"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	CardWidth        = 200
+	CardRenderHeight = 280
+	CardCorner       = 16
+	CardBorder       = 4
+	// RendererVersion is part of the cache key, bump it whenever the drawing changes
+	RendererVersion  = 1
+	CardCacheDirName = "cards"
+)
+
+var (
+	CardBackground   = color.RGBA{R: 0xff, G: 0xfb, B: 0xf0, A: 0xff}
+	FruitBorderColor = color.RGBA{R: 0xd8, G: 0x43, B: 0x15, A: 0xff}
+	AnimalBorder     = color.RGBA{R: 0x1e, G: 0x88, B: 0xe5, A: 0xff}
+)
+
+//go:embed sprites/*.png
+var spriteFiles embed.FS
+
+var sprites sync.Map
+
+// Sprite returns the bundled picture of a fruit or an animal variant
+func Sprite(cardType common.CardType, variant int) (image.Image, error) {
+	name := fmt.Sprintf("sprites/%s-%d.png", cardType, variant)
+	if cached, ok := sprites.Load(name); ok {
+		return cached.(image.Image), nil
+	}
+	content, err := spriteFiles.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("no sprite for %s %d", cardType, variant)
+	}
+	decoded, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	sprites.Store(name, decoded)
+	return decoded, nil
+}
+
+// DrawCard draws the card from its type, variant and elements
+func DrawCard(card common.Card) (image.Image, error) {
+	canvas := image.NewRGBA(image.Rect(0, 0, CardWidth, CardRenderHeight))
+	border := FruitBorderColor
+	if card.Type == common.Animal {
+		border = AnimalBorder
+	}
+	fillRoundedRect(canvas, canvas.Bounds(), CardCorner, border)
+	fillRoundedRect(canvas, canvas.Bounds().Inset(CardBorder), CardCorner-CardBorder, CardBackground)
+
+	var pictures []image.Image
+	switch card.Type {
+	case common.Animal:
+		sprite, err := Sprite(common.Animal, card.Variant)
+		if err != nil {
+			return nil, err
+		}
+		pictures = append(pictures, ScaleToHeight(sprite, CardWidth*3/4))
+	case common.Fruit:
+		for _, element := range card.Elements {
+			sprite, err := Sprite(common.Fruit, element.Variant)
+			if err != nil {
+				return nil, err
+			}
+			for i := 0; i < element.Number; i++ {
+				pictures = append(pictures, sprite)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown card type %q", card.Type)
+	}
+
+	for index, center := range Layout(len(pictures), canvas.Bounds().Inset(CardBorder*4)) {
+		bounds := pictures[index].Bounds()
+		target := image.Rect(0, 0, bounds.Dx(), bounds.Dy()).Add(center.Sub(image.Pt(bounds.Dx()/2, bounds.Dy()/2)))
+		draw.Draw(canvas, target, pictures[index], bounds.Min, draw.Over)
+	}
+	return canvas, nil
+}
+
+// Layout places count pictures in the area like the pips of a dice, in a grid beyond five
+func Layout(count int, area image.Rectangle) []image.Point {
+	var fractions [][2]float64
+	switch count {
+	case 0:
+	case 1:
+		fractions = [][2]float64{{0.5, 0.5}}
+	case 2:
+		fractions = [][2]float64{{0.5, 0.27}, {0.5, 0.73}}
+	case 3:
+		fractions = [][2]float64{{0.5, 0.18}, {0.5, 0.5}, {0.5, 0.82}}
+	case 4:
+		fractions = [][2]float64{{0.28, 0.25}, {0.72, 0.25}, {0.28, 0.75}, {0.72, 0.75}}
+	case 5:
+		fractions = [][2]float64{{0.28, 0.2}, {0.72, 0.2}, {0.5, 0.5}, {0.28, 0.8}, {0.72, 0.8}}
+	default:
+		columns := 3
+		rows := (count + columns - 1) / columns
+		for index := 0; index < count; index++ {
+			fractions = append(fractions, [2]float64{
+				(float64(index%columns) + 0.5) / float64(columns),
+				(float64(index/columns) + 0.5) / float64(rows),
+			})
+		}
+	}
+	points := make([]image.Point, len(fractions))
+	for index, fraction := range fractions {
+		points[index] = image.Pt(
+			area.Min.X+int(fraction[0]*float64(area.Dx())),
+			area.Min.Y+int(fraction[1]*float64(area.Dy())),
+		)
+	}
+	return points
+}
+
+func fillRoundedRect(canvas *image.RGBA, rect image.Rectangle, radius int, fill color.Color) {
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			// distance to the center of the nearest corner circle, zero along the straight edges
+			dx := max(rect.Min.X+radius-x, x-(rect.Max.X-1-radius), 0)
+			dy := max(rect.Min.Y+radius-y, y-(rect.Max.Y-1-radius), 0)
+			if dx*dx+dy*dy <= radius*radius {
+				canvas.Set(x, y, fill)
+			}
+		}
+	}
+}
+
+// CardKey identifies the drawing of a card, cards with the same key look the same
+func CardKey(card common.Card) string {
+	parts := []string{string(card.Type)}
+	if card.Type == common.Animal {
+		parts = append(parts, fmt.Sprint(card.Variant))
+	}
+	for _, element := range card.Elements {
+		parts = append(parts, fmt.Sprintf("%dx%d", element.Variant, element.Number))
+	}
+	parts = append(parts, fmt.Sprintf("v%d", RendererVersion))
+	return strings.Join(parts, "-")
+}
+
+// CardRenderer draws the cards itself instead of downloading Card.Image,
+// keeping the rendered pictures in memory and as PNG files in Dir if it is not empty
+type CardRenderer struct {
+	Dir    string
+	lock   sync.Mutex
+	images map[string]image.Image
+}
+
+func NewCardRenderer(dir string) *CardRenderer {
+	return &CardRenderer{
+		Dir:    dir,
+		images: make(map[string]image.Image),
+	}
+}
+
+func (renderer *CardRenderer) Load(card common.Card) (image.Image, error) {
+	key := CardKey(card)
+	renderer.lock.Lock()
+	defer renderer.lock.Unlock()
+	if cached, ok := renderer.images[key]; ok {
+		return cached, nil
+	}
+
+	path := filepath.Join(renderer.Dir, key+".png")
+	if renderer.Dir != "" {
+		if content, err := os.ReadFile(path); err == nil {
+			if decoded, err := png.Decode(bytes.NewReader(content)); err == nil {
+				renderer.images[key] = decoded
+				return decoded, nil
+			}
+		}
+	}
+
+	drawn, err := DrawCard(card)
+	if err != nil {
+		return nil, err
+	}
+	renderer.images[key] = drawn
+	// the card is still drawn in memory when the cache cannot be written, such as on a full or read-only disk
+	if renderer.Dir != "" {
+		if err = writePNG(path, drawn); err != nil {
+			slog.Error("caching card", "key", key, "err", err)
+		}
+	}
+	return drawn, nil
+}
+
+// writePNG writes to a temporary file first so that a crash never leaves a broken cache entry
+func writePNG(path string, picture image.Image) error {
+	encoded, err := EncodePNG(picture)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err = os.WriteFile(temp, encoded, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,95 @@
+package render
+
+import (
+	"encoding/json"
+	"halligalli/common"
+	"image"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDrawEveryAssetCard(t *testing.T) {
+	content, err := os.ReadFile("../assets/asset.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asset common.Asset
+	if err = json.Unmarshal(content, &asset); err != nil {
+		t.Fatal(err)
+	}
+	keys := make(map[string]bool)
+	for _, card := range asset.Cards {
+		drawn, err := DrawCard(card)
+		if err != nil {
+			t.Fatalf("card %+v cannot be drawn: %v", card, err)
+		}
+		if drawn.Bounds() != image.Rect(0, 0, CardWidth, CardRenderHeight) {
+			t.Fatalf("unexpected size %v", drawn.Bounds())
+		}
+		keys[CardKey(card)] = true
+	}
+	if len(keys) < 2 {
+		t.Fatalf("different cards should have different keys")
+	}
+
+	if _, err = DrawCard(common.Card{Type: common.Fruit, Elements: []common.CardElement{{Variant: 9, Number: 1}}}); err == nil {
+		t.Fatalf("unknown fruit should fail")
+	}
+}
+
+func TestCardRendererCachesOnDisk(t *testing.T) {
+	dir := t.TempDir()
+	card := common.Card{Type: common.Animal, Variant: 5}
+	if _, err := NewCardRenderer(dir).Load(card); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, CardKey(card)+".png")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("rendered card should be cached: %v", err)
+	}
+
+	// a new renderer reads the cached file instead of drawing again
+	cached := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	if err := writePNG(path, cached); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewCardRenderer(dir).Load(card)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Bounds() != cached.Bounds() {
+		t.Fatalf("cached card should be used, got %v", loaded.Bounds())
+	}
+}
+
+func TestCardRendererDrawsWithoutCache(t *testing.T) {
+	// the cache directory cannot be created below a file
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	drawn, err := NewCardRenderer(filepath.Join(file, "cards")).Load(common.Card{Type: common.Animal, Variant: 5})
+	if err != nil || drawn == nil {
+		t.Fatalf("card should be drawn even if it cannot be cached, got %v", err)
+	}
+}
+
+func TestLayoutStaysInArea(t *testing.T) {
+	area := image.Rect(10, 10, 110, 210)
+	for count := 0; count <= 9; count++ {
+		points := Layout(count, area)
+		if len(points) != count {
+			t.Fatalf("%d pictures placed for %d", len(points), count)
+		}
+		for _, point := range points {
+			if !point.In(area) {
+				t.Fatalf("point %v of %d pictures is out of %v", point, count, area)
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package render
+
+import (
+	"halligalli/assets"
+	"halligalli/common"
+	"strings"
+)
+
+// EmptyCard is shown for a fruit card without any fruit
+const EmptyCard = "⬜"
+
+// NameFunc gives the name of a fruit or an animal variant in the language of the message
+type NameFunc func(cardType common.CardType, variant int) string
+
+// AssetName is the name of the variant in the asset file
+func AssetName(cardType common.CardType, variant int) string {
+	if cardType == common.Animal {
+		return assets.GetAnimalNameByVariant(variant)
+	}
+	return assets.GetFruitNameByVariant(variant)
+}
+
+// CardText writes the card with the emoji of its variants, such as "🍓🍓🍐" or "🐼 熊猫",
+// falling back to the names for variants without an emoji
+func CardText(card common.Card, name NameFunc) string {
+	if card.Type == common.Animal {
+		emoji := assets.GetAnimalEmojiByVariant(card.Variant)
+		return strings.TrimSpace(emoji + " " + name(common.Animal, card.Variant))
+	}
+	var builder strings.Builder
+	for _, element := range card.Elements {
+		emoji := assets.GetFruitEmojiByVariant(element.Variant)
+		if emoji == "" {
+			emoji = "[" + name(common.Fruit, element.Variant) + "]"
+		}
+		builder.WriteString(strings.Repeat(emoji, element.Number))
+	}
+	if builder.Len() == 0 {
+		return EmptyCard
+	}
+	return builder.String()
+}
+
+// BoardText writes the cards in the order of the board, the last one being the newest
+func BoardText(cards []common.Card, name NameFunc) string {
+	texts := make([]string, len(cards))
+	for index, card := range cards {
+		texts[index] = CardText(card, name)
+	}
+	return strings.Join(texts, " | ")
+}
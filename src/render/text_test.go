@@ -0,0 +1,31 @@
+package render
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"testing"
+)
+
+func TestCardText(t *testing.T) {
+	env.GetContext().Asset.Meta = common.AssetMeta{
+		Fruits: []common.AssetVariant{
+			{Name: "草莓", Variant: 1, Emoji: "🍓"},
+			{Name: "青梨", Variant: 2, Emoji: "🍐"},
+			{Name: "杨桃", Variant: 9},
+		},
+		Animals: []common.AssetVariant{{Name: "熊猫", Variant: 5, Emoji: "🐼"}},
+	}
+	for _, test := range []struct {
+		card     common.Card
+		expected string
+	}{
+		{common.Card{Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 2}, {Variant: 2, Number: 1}}}, "🍓🍓🍐"},
+		{common.Card{Type: common.Fruit, Elements: []common.CardElement{{Variant: 9, Number: 2}}}, "[杨桃][杨桃]"},
+		{common.Card{Type: common.Fruit}, EmptyCard},
+		{common.Card{Type: common.Animal, Variant: 5}, "🐼 熊猫"},
+	} {
+		if text := CardText(test.card, AssetName); text != test.expected {
+			t.Errorf("card %+v should be %q, got %q", test.card, test.expected, text)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package rules
+
+import (
+	"halligalli/common"
+	"sort"
+)
+
+// Verdict describes whether the bell should be rung for a window of cards
+type Verdict struct {
+	Ring bool
+	// Animals holds the variants of every animal card in the window
+	Animals []int
+	// Fruits holds the variants whose total equals the number to win
+	Fruits      []int
+	FruitTotals map[int]int
+}
+
+func (verdict Verdict) HasAnimal() bool {
+	return len(verdict.Animals) > 0
+}
+
+func (verdict Verdict) HasFruit() bool {
+	return len(verdict.Fruits) > 0
+}
+
+// Window returns the last cards of the revealed ones that take part in the check
+func Window(revealed []common.Card, rule common.Rule) []common.Card {
+	sliceFrom := len(revealed) - rule.ValidCardNumber
+	if sliceFrom < 0 {
+		sliceFrom = 0
+	}
+	return revealed[sliceFrom:]
+}
+
+// Check tells if the window contains an animal or exactly the number of the same fruit to win
+func Check(window []common.Card, rule common.Rule) Verdict {
+	verdict := Verdict{
+		Animals:     make([]int, 0),
+		Fruits:      make([]int, 0),
+		FruitTotals: make(map[int]int),
+	}
+	for _, card := range window {
+		switch card.Type {
+		case common.Fruit:
+			for _, element := range card.Elements {
+				verdict.FruitTotals[element.Variant] += element.Number
+			}
+		case common.Animal:
+			verdict.Animals = append(verdict.Animals, card.Variant)
+		}
+	}
+	for variant, total := range verdict.FruitTotals {
+		if total == rule.FruitNumberToWin {
+			verdict.Fruits = append(verdict.Fruits, variant)
+		}
+	}
+	sort.Ints(verdict.Fruits)
+	verdict.Ring = verdict.HasAnimal() || verdict.HasFruit()
+	return verdict
+}
@@ -0,0 +1,240 @@
+package rules
+
+import (
+	"encoding/json"
+	"halligalli/common"
+	"os"
+	"testing"
+	"time"
+)
+
+var defaultRule = common.Rule{
+	ValidCardNumber:  5,
+	FruitNumberToWin: 5,
+	DealInterval:     7 * time.Second,
+}
+
+func loadAsset(t *testing.T) common.Asset {
+	t.Helper()
+	content, err := os.ReadFile("../assets/asset.json")
+	if err != nil {
+		t.Fatalf("reading asset: %v", err)
+	}
+	var asset common.Asset
+	if err = json.Unmarshal(content, &asset); err != nil {
+		t.Fatalf("parsing asset: %v", err)
+	}
+	return asset
+}
+
+func fruitCard(elements ...common.CardElement) common.Card {
+	return common.Card{Type: common.Fruit, Elements: elements}
+}
+
+func animalCard(variant int) common.Card {
+	return common.Card{Type: common.Animal, Variant: variant}
+}
+
+func fruit(variant int, number int) common.CardElement {
+	return common.CardElement{Variant: variant, Number: number}
+}
+
+func TestAssetVariantsExistInMeta(t *testing.T) {
+	asset := loadAsset(t)
+	fruits := make(map[int]bool)
+	for _, variant := range asset.Meta.Fruits {
+		fruits[variant.Variant] = true
+	}
+	animals := make(map[int]bool)
+	for _, variant := range asset.Meta.Animals {
+		animals[variant.Variant] = true
+	}
+	for _, card := range asset.Cards {
+		switch card.Type {
+		case common.Fruit:
+			if len(card.Elements) == 0 {
+				t.Errorf("%s: fruit card without elements", card.Image)
+			}
+			for _, element := range card.Elements {
+				if !fruits[element.Variant] {
+					t.Errorf("%s: unknown fruit variant %d", card.Image, element.Variant)
+				}
+				if element.Number <= 0 {
+					t.Errorf("%s: invalid fruit number %d", card.Image, element.Number)
+				}
+			}
+		case common.Animal:
+			if !animals[card.Variant] {
+				t.Errorf("%s: unknown animal variant %d", card.Image, card.Variant)
+			}
+		default:
+			t.Errorf("%s: unknown card type %q", card.Image, card.Type)
+		}
+	}
+}
+
+// every card in the asset is checked on its own and after four cards of another fruit
+func TestCheckEveryAssetCard(t *testing.T) {
+	asset := loadAsset(t)
+	for _, card := range asset.Cards {
+		t.Run(card.Image, func(t *testing.T) {
+			verdict := Check([]common.Card{card}, defaultRule)
+			if card.Type == common.Animal {
+				if !verdict.Ring || len(verdict.Animals) != 1 || verdict.Animals[0] != card.Variant {
+					t.Fatalf("animal card should ring with variant %d, got %+v", card.Variant, verdict)
+				}
+				return
+			}
+
+			expected := make(map[int]int)
+			shouldRing := false
+			for _, element := range card.Elements {
+				expected[element.Variant] += element.Number
+			}
+			for _, total := range expected {
+				if total == defaultRule.FruitNumberToWin {
+					shouldRing = true
+				}
+			}
+			if verdict.Ring != shouldRing {
+				t.Fatalf("ring should be %t, got %+v", shouldRing, verdict)
+			}
+			for variant, total := range expected {
+				if verdict.FruitTotals[variant] != total {
+					t.Fatalf("fruit %d total should be %d, got %d", variant, total, verdict.FruitTotals[variant])
+				}
+			}
+
+			// complete each fruit on the card up to the number to win with single fruit cards
+			for variant, total := range expected {
+				if total >= defaultRule.FruitNumberToWin {
+					continue
+				}
+				window := []common.Card{card}
+				for i := total; i < defaultRule.FruitNumberToWin && len(window) < defaultRule.ValidCardNumber; i++ {
+					window = append(window, fruitCard(fruit(variant, 1)))
+				}
+				if verdict := Check(window, defaultRule); verdict.FruitTotals[variant] == defaultRule.FruitNumberToWin &&
+					!verdict.Ring {
+					t.Fatalf("window %+v should ring, got %+v", window, verdict)
+				}
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  []common.Card
+		ring    bool
+		fruits  []int
+		animals []int
+	}{
+		{
+			name:   "empty window",
+			window: []common.Card{},
+		},
+		{
+			name:   "fruits accumulate across cards",
+			window: []common.Card{fruitCard(fruit(1, 2)), fruitCard(fruit(1, 3))},
+			ring:   true,
+			fruits: []int{1},
+		},
+		{
+			name: "fruits accumulate across mixed cards",
+			window: []common.Card{
+				fruitCard(fruit(1, 1), fruit(2, 1)),
+				fruitCard(fruit(2, 2)),
+				fruitCard(fruit(1, 3), fruit(3, 1)),
+				fruitCard(fruit(1, 1)),
+			},
+			ring:   true,
+			fruits: []int{1},
+		},
+		{
+			name:   "more than the number to win does not ring",
+			window: []common.Card{fruitCard(fruit(1, 4)), fruitCard(fruit(1, 2))},
+		},
+		{
+			name:   "different fruits do not add up",
+			window: []common.Card{fruitCard(fruit(1, 3)), fruitCard(fruit(2, 2))},
+		},
+		{
+			name:    "any animal rings",
+			window:  []common.Card{fruitCard(fruit(1, 1)), animalCard(3)},
+			ring:    true,
+			animals: []int{3},
+		},
+		{
+			name:    "animal and fruit both reported",
+			window:  []common.Card{fruitCard(fruit(4, 5)), animalCard(2)},
+			ring:    true,
+			fruits:  []int{4},
+			animals: []int{2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			verdict := Check(test.window, defaultRule)
+			if verdict.Ring != test.ring {
+				t.Errorf("ring should be %t, got %+v", test.ring, verdict)
+			}
+			if !equalInts(verdict.Fruits, test.fruits) {
+				t.Errorf("fruits should be %v, got %v", test.fruits, verdict.Fruits)
+			}
+			if !equalInts(verdict.Animals, test.animals) {
+				t.Errorf("animals should be %v, got %v", test.animals, verdict.Animals)
+			}
+		})
+	}
+}
+
+func TestCheckFollowsRule(t *testing.T) {
+	window := []common.Card{fruitCard(fruit(2, 3)), fruitCard(fruit(2, 3))}
+	if Check(window, defaultRule).Ring {
+		t.Errorf("6 fruits should not ring with target 5")
+	}
+	rule := defaultRule
+	rule.FruitNumberToWin = 6
+	if !Check(window, rule).Ring {
+		t.Errorf("6 fruits should ring with target 6")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	revealed := []common.Card{
+		animalCard(1),
+		fruitCard(fruit(1, 1)),
+		fruitCard(fruit(1, 1)),
+		fruitCard(fruit(1, 1)),
+		fruitCard(fruit(1, 1)),
+		fruitCard(fruit(1, 1)),
+	}
+	window := Window(revealed, defaultRule)
+	if len(window) != defaultRule.ValidCardNumber {
+		t.Fatalf("window should hold %d cards, got %d", defaultRule.ValidCardNumber, len(window))
+	}
+	verdict := Check(window, defaultRule)
+	if verdict.HasAnimal() {
+		t.Errorf("animal out of the window should not count, got %+v", verdict)
+	}
+	if !verdict.Ring {
+		t.Errorf("5 strawberries in the window should ring, got %+v", verdict)
+	}
+	if len(Window(revealed[:2], defaultRule)) != 2 {
+		t.Errorf("short history should be returned as a whole")
+	}
+}
+
+func equalInts(a []int, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"halligalli/common"
+	"halligalli/game"
+	"halligalli/model"
+	"halligalli/render"
+	"log/slog"
+	"time"
+)
+
+// BuildCardMessage shows the revealed card in the display mode of the channel, prepare renders
+// the board of image messages and the text returned is sent instead if the image cannot be
+func BuildCardMessage(revealed game.RevealedCard, text string) (model.MessageSendBody, func(body *model.MessageSendBody), string) {
+	switch revealed.Display {
+	case common.DisplayText:
+		return model.MessageSendBody{Content: text}, nil, ""
+	case common.DisplayBoth:
+		return model.MessageSendBody{Content: text, ImageUrl: revealed.Card.Image}, RenderBoard(revealed.Window), text
+	default:
+		return model.MessageSendBody{ImageUrl: revealed.Card.Image}, RenderBoard(revealed.Window), text
+	}
+}
+
+// TextFallback is the body without its image, replying to the same message
+func TextFallback(body model.MessageSendBody, text string) *model.MessageSendBody {
+	body.Content = text
+	body.ImageUrl = ""
+	body.FileImage = nil
+	return &body
+}
+
+// BoardRenderTimeout bounds the time the worker of the channel waits for a board, later cards would wait as well
+const BoardRenderTimeout = 2 * time.Second
+
+// RenderBoard replaces the image of the new card with the whole window uploaded as a file,
+// the image of the card is kept if the board cannot be rendered in time
+func RenderBoard(window []common.Card) func(body *model.MessageSendBody) {
+	return renderBoard(window, render.DefaultLoader, BoardRenderTimeout)
+}
+
+func renderBoard(window []common.Card, loader render.ImageLoader, timeout time.Duration) func(body *model.MessageSendBody) {
+	return func(body *model.MessageSendBody) {
+		if len(window) == 0 {
+			return
+		}
+		// a board finished after the deadline is dropped, the cards it loaded are still cached for the next one
+		rendered := make(chan []byte, 1)
+		go func() {
+			board, err := render.Board(window, loader)
+			var encoded []byte
+			if err == nil {
+				encoded, err = render.EncodePNG(board)
+			}
+			if err != nil {
+				slog.Error("rendering board", "err", err)
+			}
+			rendered <- encoded
+		}()
+		select {
+		case encoded := <-rendered:
+			if encoded == nil {
+				return
+			}
+			body.FileImage = encoded
+			body.ImageUrl = ""
+		case <-time.After(timeout):
+			slog.Error("board not rendered in time, sending the image of the card", "timeout", timeout)
+		}
+	}
+}
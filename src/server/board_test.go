@@ -0,0 +1,41 @@
+package server
+
+import (
+	"halligalli/common"
+	"halligalli/model"
+	"image"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+type slowLoader time.Duration
+
+func (loader slowLoader) Load(common.Card) (image.Image, error) {
+	time.Sleep(time.Duration(loader))
+	return image.NewRGBA(image.Rect(0, 0, 10, 10)), nil
+}
+
+func TestRenderBoardFallsBackToImageAfterDeadline(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	window := []common.Card{{Image: "https://example.com/card.png"}}
+
+	body := model.MessageSendBody{ImageUrl: window[0].Image}
+	renderBoard(window, slowLoader(0), time.Second)(&body)
+	if len(body.FileImage) == 0 || body.ImageUrl != "" {
+		t.Fatalf("board should replace the image of the card, got %+v", body)
+	}
+
+	body = model.MessageSendBody{ImageUrl: window[0].Image}
+	start := time.Now()
+	renderBoard(window, slowLoader(time.Second), 10*time.Millisecond)(&body)
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("slow board should not hold the worker back")
+	}
+	if body.FileImage != nil || body.ImageUrl != window[0].Image {
+		t.Fatalf("image of the card should be sent instead of a late board, got %+v", body)
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"fmt"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Command struct {
+	Name      string
+	Aliases   []string
+	EventType game.EventType
+	// ParseParam builds the event param from the arguments following the command word
+	ParseParam func(args []string, messageCreateBody model.MessageCreateBody) (any, error)
+	// GluedArgs lets a chinese alias be followed by its first argument without a space
+	GluedArgs bool
+}
+
+// RingCommand is used when the message only mentions the bot
+var RingCommand = Command{
+	Name:       "ring",
+	Aliases:    []string{"bell", "按铃", "铃", "🔔"},
+	EventType:  game.RingTheBell,
+	ParseParam: ParseRing,
+}
+
+var Commands = []Command{
+	{
+		Name:       "game",
+		Aliases:    []string{"游戏", "开局"},
+		EventType:  game.Initiate,
+		ParseParam: ParseMode,
+		GluedArgs:  true,
+	},
+	{
+		Name:      "start",
+		Aliases:   []string{"开始"},
+		EventType: game.Start,
+	},
+	{
+		Name:      "continue",
+		Aliases:   []string{"继续"},
+		EventType: game.Continue,
+	},
+	{
+		Name:      "stop",
+		Aliases:   []string{"停止", "结束"},
+		EventType: game.Terminate,
+	},
+	{
+		Name:      "why",
+		Aliases:   []string{"debug", "为什么"},
+		EventType: game.Debug,
+	},
+	{
+		Name:      "score",
+		Aliases:   []string{"得分", "分数"},
+		EventType: game.Score,
+	},
+	{
+		Name:      "stats",
+		Aliases:   []string{"统计", "战绩"},
+		EventType: game.Stats,
+	},
+	{
+		Name:      "deck",
+		Aliases:   []string{"牌组"},
+		EventType: game.DeckInfo,
+	},
+	{
+		Name:       "join",
+		Aliases:    []string{"加入"},
+		EventType:  game.Join,
+		ParseParam: ParseAuthor,
+	},
+	{
+		Name:       "leave",
+		Aliases:    []string{"退出"},
+		EventType:  game.Leave,
+		ParseParam: ParseAuthor,
+	},
+	{
+		Name:       "config",
+		Aliases:    []string{"设置"},
+		EventType:  game.Configure,
+		ParseParam: ParseRuleConfig,
+		GluedArgs:  true,
+	},
+	RingCommand,
+}
+
+func ParseAuthor(_ []string, messageCreateBody model.MessageCreateBody) (any, error) {
+	return messageCreateBody.Author, nil
+}
+
+// ParseRing takes the server timestamp of the message as the time the bell was rung,
+// the receive time is kept to measure the reaction on the same clock as reveals
+func ParseRing(_ []string, messageCreateBody model.MessageCreateBody) (any, error) {
+	receivedAt := time.Now()
+	timestamp, err := time.Parse(time.RFC3339, messageCreateBody.Timestamp)
+	if err != nil {
+		slog.Error("parsing message timestamp, ranking the ring by its receive time", "err", err)
+		timestamp = time.Time{}
+	}
+	seq, err := strconv.Atoi(messageCreateBody.SeqInChannel)
+	if err != nil {
+		seq = 0
+	}
+	return game.Ring{
+		Player:     messageCreateBody.Author,
+		Timestamp:  timestamp,
+		Seq:        seq,
+		ReceivedAt: receivedAt,
+	}, nil
+}
+
+func ParseMode(args []string, _ model.MessageCreateBody) (any, error) {
+	if len(args) == 0 {
+		return game.Classic, nil
+	}
+	switch strings.ToLower(args[0]) {
+	case "classic", "经典":
+		return game.Classic, nil
+	case "tabletop", "桌游":
+		return game.Tabletop, nil
+	}
+	return nil, fmt.Errorf("unknown game mode %q", args[0])
+}
+
+func ParseRuleConfig(args []string, _ model.MessageCreateBody) (any, error) {
+	var config game.RuleConfig
+	if len(args) > 0 {
+		config.Key = strings.ToLower(args[0])
+	}
+	if len(args) > 1 {
+		config.Value = strings.ToLower(args[1])
+	}
+	// such as "config locale en guild"
+	if len(args) > 2 {
+		switch strings.ToLower(args[2]) {
+		case "guild", "全频道":
+			return GuildConfig{Key: config.Key, Value: config.Value}, nil
+		default:
+			return nil, fmt.Errorf("unknown scope %q", args[2])
+		}
+	}
+	return config, nil
+}
+
+// Tokenize splits the message content into words after removing the bot mention
+func Tokenize(content string, botId string) []string {
+	content = strings.ReplaceAll(content, fmt.Sprintf("<@!%s>", botId), " ")
+	content = strings.ReplaceAll(content, fmt.Sprintf("<@%s>", botId), " ")
+	return strings.Fields(content)
+}
+
+func FindCommand(word string) (Command, bool) {
+	word = strings.ToLower(word)
+	for _, command := range Commands {
+		if command.Name == word {
+			return command, true
+		}
+		for _, alias := range command.Aliases {
+			if alias == word {
+				return command, true
+			}
+		}
+	}
+	return Command{}, false
+}
+
+// SplitAlias finds the longest chinese alias the word starts with, as chinese is written without spaces,
+// the rest of the word being the first argument. Only commands with GluedArgs take such an argument,
+// so "结束了吗" stops nothing. Latin names and aliases must be whole words.
+func SplitAlias(word string) (Command, string, bool) {
+	var found Command
+	var length int
+	for _, command := range Commands {
+		for _, alias := range command.Aliases {
+			if len(alias) > length && !isLatin(alias) && strings.HasPrefix(word, alias) &&
+				(command.GluedArgs || len(alias) == len(word)) {
+				found, length = command, len(alias)
+			}
+		}
+	}
+	return found, word[length:], length > 0
+}
+
+func isLatin(word string) bool {
+	for _, char := range word {
+		if char >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseCommand returns the matched command and its arguments,
+// a message with nothing but the mention rings the bell.
+// The first word must be a command, so "<@!bot> I can't stop" is no command but "<@!bot>游戏桌游" starts a tabletop game.
+func ParseCommand(content string, botId string) (Command, []string, bool) {
+	tokens := Tokenize(content, botId)
+	if len(tokens) == 0 {
+		return RingCommand, nil, true
+	}
+	if command, ok := FindCommand(tokens[0]); ok {
+		return command, tokens[1:], true
+	}
+	command, rest, ok := SplitAlias(tokens[0])
+	if !ok {
+		return Command{}, nil, false
+	}
+	return command, append([]string{rest}, tokens[1:]...), true
+}
+
+func BuildCommandEvent(messageCreateBody model.MessageCreateBody) (game.Event, error) {
+	command, args, ok := ParseCommand(messageCreateBody.Content, env.GetContext().User.Id)
+	if !ok {
+		return game.Event{}, fmt.Errorf("unknown command in %q", messageCreateBody.Content)
+	}
+	return NewCommandEvent(command, args, messageCreateBody)
+}
+
+func NewCommandEvent(command Command, args []string, messageCreateBody model.MessageCreateBody) (game.Event, error) {
+	var param any
+	if command.ParseParam != nil {
+		var err error
+		if param, err = command.ParseParam(args, messageCreateBody); err != nil {
+			return game.Event{}, err
+		}
+	}
+	return game.Event{
+		EventType: command.EventType,
+		ReplyContext: game.ReplyContext{
+			MessageId: messageCreateBody.Id,
+			GuildId:   messageCreateBody.GuildId,
+			ChannelId: messageCreateBody.ChannelId,
+		},
+		Param: param,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"halligalli/game"
+	"halligalli/model"
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		command string
+		args    []string
+		ok      bool
+	}{
+		{name: "mention with exclamation mark", content: "<@!bot> start", command: "start", args: []string{}, ok: true},
+		{name: "mention without exclamation mark", content: "<@bot> start", command: "start", args: []string{}, ok: true},
+		{name: "mention after the command", content: "score <@!bot>", command: "score", args: []string{}, ok: true},
+		{name: "case is ignored", content: "<@!bot> STOP", command: "stop", args: []string{}, ok: true},
+		{name: "arguments follow the command", content: "<@!bot> config interval 5s", command: "config", args: []string{"interval", "5s"}, ok: true},
+		{name: "chinese start alias", content: "<@!bot> 开始", command: "start", args: []string{}, ok: true},
+		{name: "chinese stop alias", content: "<@!bot> 停止", command: "stop", args: []string{}, ok: true},
+		{name: "chinese why alias", content: "<@!bot> 为什么", command: "why", args: []string{}, ok: true},
+		{name: "chinese alias glued to the mention", content: "<@!bot>开始", command: "start", args: []string{}, ok: true},
+		{name: "chinese alias without arguments glued to more text", content: "<@!bot>开始游戏", ok: false},
+		{name: "question glued to the stop alias", content: "<@!bot> 结束了吗", ok: false},
+		{name: "question glued to the start alias", content: "<@!bot> 开始了吗", ok: false},
+		{name: "remark glued to the ring alias", content: "<@!bot> 铃声好吵", ok: false},
+		{name: "config key glued to the alias", content: "<@!bot>设置deck kids", command: "config", args: []string{"deck", "kids"}, ok: true},
+		{name: "game mode glued to the alias", content: "<@!bot> 游戏桌游", command: "game", args: []string{"桌游"}, ok: true},
+		{name: "empty message rings", content: "<@!bot>", command: "ring", ok: true},
+		{name: "blank message rings", content: "  <@bot>  ", command: "ring", ok: true},
+		{name: "unknown first word", content: "<@!bot> hello", ok: false},
+		{name: "command not in first place", content: "<@!bot> I can't stop", ok: false},
+		{name: "latin alias is a whole word", content: "<@!bot> stopwatch", ok: false},
+		{name: "mention of someone else is a word", content: "<@!other> start", ok: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			command, args, ok := ParseCommand(test.content, "bot")
+			if ok != test.ok {
+				t.Fatalf("expected matched %t, got %t with %+v", test.ok, ok, command)
+			}
+			if !ok {
+				return
+			}
+			if command.Name != test.command || !reflect.DeepEqual(args, test.args) {
+				t.Fatalf("expected %s %q, got %s %q", test.command, test.args, command.Name, args)
+			}
+		})
+	}
+}
+
+func TestParseRuleConfigScope(t *testing.T) {
+	if config, err := ParseRuleConfig([]string{"Locale", "EN"}, model.MessageCreateBody{}); err != nil || config != (game.RuleConfig{Key: "locale", Value: "en"}) {
+		t.Fatalf("setting should apply to the channel, got %+v %v", config, err)
+	}
+	if config, err := ParseRuleConfig([]string{"locale", "en", "全频道"}, model.MessageCreateBody{}); err != nil || config != (GuildConfig{Key: "locale", Value: "en"}) {
+		t.Fatalf("setting should apply to the guild, got %+v %v", config, err)
+	}
+	if _, err := ParseRuleConfig([]string{"locale", "en", "world"}, model.MessageCreateBody{}); err == nil {
+		t.Fatalf("unknown scope should be refused")
+	}
+}
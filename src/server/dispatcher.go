@@ -0,0 +1,196 @@
+package server
+
+import (
+	"errors"
+	"halligalli/model"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	OutboxSize = 64
+	// DispatchTimeout is how long a message waits for room in a full outbox before it is dropped
+	DispatchTimeout = 30 * time.Second
+	// OutboxIdleTimeout stops the worker of a channel that has nothing to send
+	OutboxIdleTimeout = time.Minute
+	MaxSendAttempts   = 5
+	MinRetryBackoff   = 500 * time.Millisecond
+	MaxRetryBackoff   = 30 * time.Second
+	// ChannelSendInterval and GlobalSendInterval keep the bot under the OpenAPI rate limits
+	ChannelSendInterval = 200 * time.Millisecond
+	GlobalSendInterval  = 50 * time.Millisecond
+)
+
+type OutgoingMessage struct {
+	ChannelId string
+	Body      model.MessageSendBody
+	// Prepare completes the body in the worker of the channel right before sending, it may be nil
+	Prepare func(body *model.MessageSendBody)
+	// Fallback is sent instead once the body cannot be sent, such as a text for an image, it may be nil
+	Fallback *model.MessageSendBody
+	// OnSent is called once the message is sent or given up, it may be nil
+	OnSent func(response model.MessageResponseBody, err error)
+}
+
+// RateLimiter spaces the calls to Wait by at least the interval
+type RateLimiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+func (limiter *RateLimiter) Wait() {
+	limiter.lock.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.lock.Unlock()
+	time.Sleep(delay)
+}
+
+type outbox struct {
+	messages chan OutgoingMessage
+	// senders are waiting for room in the outbox, the worker does not stop while there are some
+	senders int
+}
+
+// Dispatcher sends messages through one worker per channel, so that messages of a channel
+// are sent one at a time and in order, retrying the ones that failed before sending the next
+type Dispatcher struct {
+	Send            func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error)
+	ChannelInterval time.Duration
+	MinBackoff      time.Duration
+	MaxBackoff      time.Duration
+	MaxAttempts     int
+	IdleTimeout     time.Duration
+	DispatchTimeout time.Duration
+	global          *RateLimiter
+	lock            sync.Mutex
+	outboxes        map[string]*outbox
+}
+
+var DefaultDispatcher = NewDispatcher()
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Send:            SendMessage,
+		ChannelInterval: ChannelSendInterval,
+		MinBackoff:      MinRetryBackoff,
+		MaxBackoff:      MaxRetryBackoff,
+		MaxAttempts:     MaxSendAttempts,
+		IdleTimeout:     OutboxIdleTimeout,
+		DispatchTimeout: DispatchTimeout,
+		global:          NewRateLimiter(GlobalSendInterval),
+		outboxes:        make(map[string]*outbox),
+	}
+}
+
+// Dispatch queues the message, waiting for room while the outbox of the channel is full,
+// it returns false if the outbox is still full after the dispatch timeout.
+// Only the caller waits, the other channels keep being dispatched to
+func (dispatcher *Dispatcher) Dispatch(message OutgoingMessage) bool {
+	dispatcher.lock.Lock()
+	box, ok := dispatcher.outboxes[message.ChannelId]
+	if !ok {
+		box = &outbox{messages: make(chan OutgoingMessage, OutboxSize)}
+		dispatcher.outboxes[message.ChannelId] = box
+		go dispatcher.work(message.ChannelId, box)
+	}
+	select {
+	case box.messages <- message:
+		dispatcher.lock.Unlock()
+		return true
+	default:
+	}
+	box.senders += 1
+	dispatcher.lock.Unlock()
+
+	timeout := time.NewTimer(dispatcher.DispatchTimeout)
+	defer timeout.Stop()
+	select {
+	case box.messages <- message:
+		ok = true
+	case <-timeout.C:
+		ok = false
+	}
+	dispatcher.lock.Lock()
+	box.senders -= 1
+	dispatcher.lock.Unlock()
+	return ok
+}
+
+func (dispatcher *Dispatcher) work(channelId string, box *outbox) {
+	limiter := NewRateLimiter(dispatcher.ChannelInterval)
+	idle := time.NewTimer(dispatcher.IdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case message := <-box.messages:
+			if message.Prepare != nil {
+				message.Prepare(&message.Body)
+			}
+			limiter.Wait()
+			response, err := dispatcher.deliver(message.ChannelId, &message.Body)
+			if err != nil && message.Fallback != nil {
+				slog.Error("sending message, sending its fallback", "channel", message.ChannelId, "err", err)
+				limiter.Wait()
+				response, err = dispatcher.deliver(message.ChannelId, message.Fallback)
+			}
+			if message.OnSent != nil {
+				message.OnSent(response, err)
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(dispatcher.IdleTimeout)
+		case <-idle.C:
+			// senders are counted while holding the lock, so the outbox stays empty once removed
+			dispatcher.lock.Lock()
+			if len(box.messages) == 0 && box.senders == 0 {
+				delete(dispatcher.outboxes, channelId)
+				dispatcher.lock.Unlock()
+				return
+			}
+			dispatcher.lock.Unlock()
+			idle.Reset(dispatcher.IdleTimeout)
+		}
+	}
+}
+
+func (dispatcher *Dispatcher) deliver(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+	backoff := dispatcher.MinBackoff
+	for attempt := 1; ; attempt++ {
+		dispatcher.global.Wait()
+		response, err := dispatcher.Send(channelId, body)
+		if err == nil || attempt >= dispatcher.MaxAttempts || !IsRetryable(err) {
+			return response, err
+		}
+		delay := backoff
+		var apiError *APIError
+		if errors.As(err, &apiError) && apiError.RetryAfter > delay {
+			delay = apiError.RetryAfter
+		}
+		slog.Error("sending message, retrying", "channel", channelId, "delay", delay, "err", err)
+		time.Sleep(delay)
+		backoff = minDuration(backoff*2, dispatcher.MaxBackoff)
+	}
+}
+
+// IsRetryable reports whether the error is temporary, such as rate limiting, a server error or a network failure
+func IsRetryable(err error) bool {
+	var apiError *APIError
+	if errors.As(err, &apiError) {
+		return apiError.Retryable()
+	}
+	var netError net.Error
+	return errors.As(err, &netError)
+}
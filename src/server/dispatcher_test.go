@@ -0,0 +1,235 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"halligalli/model"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherKeepsOrderWhileRetrying(t *testing.T) {
+	const channels = 3
+	const messages = 20
+	var lock sync.Mutex
+	sent := make(map[string][]string)
+	attempts := make(map[string]int)
+
+	dispatcher := NewDispatcher()
+	dispatcher.ChannelInterval = time.Millisecond
+	dispatcher.MinBackoff = time.Millisecond
+	dispatcher.MaxBackoff = 5 * time.Millisecond
+	dispatcher.global = NewRateLimiter(0)
+	dispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		attempts[body.Content] += 1
+		// every third message is rate limited once and every fifth fails twice
+		switch {
+		case body.Content[len(body.Content)-1] == '3' && attempts[body.Content] == 1:
+			return model.MessageResponseBody{}, &APIError{StatusCode: http.StatusTooManyRequests, Code: 22009}
+		case body.Content[len(body.Content)-1] == '5' && attempts[body.Content] <= 2:
+			return model.MessageResponseBody{}, &APIError{StatusCode: http.StatusBadGateway}
+		}
+		sent[channelId] = append(sent[channelId], body.Content)
+		return model.MessageResponseBody{Id: body.Content}, nil
+	}
+
+	var done sync.WaitGroup
+	for i := 0; i < messages; i++ {
+		for channel := 0; channel < channels; channel++ {
+			channelId := fmt.Sprintf("channel-%d", channel)
+			content := fmt.Sprintf("%s/%d", channelId, i)
+			done.Add(1)
+			ok := dispatcher.Dispatch(OutgoingMessage{
+				ChannelId: channelId,
+				Body:      model.MessageSendBody{Content: content},
+				OnSent: func(response model.MessageResponseBody, err error) {
+					defer done.Done()
+					if err != nil || response.Id != content {
+						t.Errorf("message %s not sent: %v", content, err)
+					}
+				},
+			})
+			if !ok {
+				t.Fatalf("outbox of %s should not be full", channelId)
+			}
+		}
+	}
+	done.Wait()
+
+	for channel := 0; channel < channels; channel++ {
+		channelId := fmt.Sprintf("channel-%d", channel)
+		if len(sent[channelId]) != messages {
+			t.Fatalf("%s sent %d messages", channelId, len(sent[channelId]))
+		}
+		for i, content := range sent[channelId] {
+			if content != fmt.Sprintf("%s/%d", channelId, i) {
+				t.Fatalf("%s sent %s at position %d", channelId, content, i)
+			}
+		}
+	}
+}
+
+func TestDispatcherGivesUpOnPermanentErrors(t *testing.T) {
+	dispatcher := NewDispatcher()
+	dispatcher.global = NewRateLimiter(0)
+	calls := 0
+	dispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		calls += 1
+		return model.MessageResponseBody{}, &APIError{StatusCode: http.StatusBadRequest, Code: 40034}
+	}
+	result := make(chan error)
+	dispatcher.Dispatch(OutgoingMessage{
+		ChannelId: "channel",
+		OnSent: func(_ model.MessageResponseBody, err error) {
+			result <- err
+		},
+	})
+	err := <-result
+	var apiError *APIError
+	if !errors.As(err, &apiError) || apiError.Code != 40034 || calls != 1 {
+		t.Fatalf("bad request should not be retried, got %v after %d calls", err, calls)
+	}
+}
+
+func TestNewAPIErrorParsesBody(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "2")
+	err := NewAPIError(HttpResponse{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     header,
+		Body:       []byte(`{"code":22009,"message":"msg limit exceed","trace_id":"abc"}`),
+	})
+	if err.Code != 22009 || err.Message != "msg limit exceed" || err.TraceId != "abc" || err.RetryAfter != 2*time.Second {
+		t.Fatalf("unexpected error %+v", err)
+	}
+	if !err.Retryable() {
+		t.Fatalf("rate limited requests should be retried")
+	}
+}
+
+func TestDispatcherSendsFallbackOfFailedMessage(t *testing.T) {
+	dispatcher := NewDispatcher()
+	dispatcher.global = NewRateLimiter(0)
+	var sent []model.MessageSendBody
+	dispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		sent = append(sent, *body)
+		if body.ImageUrl != "" {
+			return model.MessageResponseBody{}, &APIError{StatusCode: http.StatusBadRequest, Code: 304003}
+		}
+		return model.MessageResponseBody{Id: "text"}, nil
+	}
+	result := make(chan error)
+	dispatcher.Dispatch(OutgoingMessage{
+		ChannelId: "channel",
+		Body:      model.MessageSendBody{ImageUrl: "https://example.com/card.png", ReplyMessageId: "reply"},
+		Fallback:  TextFallback(model.MessageSendBody{ImageUrl: "https://example.com/card.png", ReplyMessageId: "reply"}, "🍓🍓"),
+		OnSent: func(response model.MessageResponseBody, err error) {
+			if response.Id != "text" {
+				t.Errorf("response of the fallback should be reported, got %+v", response)
+			}
+			result <- err
+		},
+	})
+	if err := <-result; err != nil {
+		t.Fatalf("fallback should be sent, got %v", err)
+	}
+	if len(sent) != 2 || sent[1].Content != "🍓🍓" || sent[1].ImageUrl != "" || sent[1].ReplyMessageId != "reply" {
+		t.Fatalf("image should be replaced by its text, sent %+v", sent)
+	}
+}
+
+func TestDispatchWaitsForRoomInFullOutbox(t *testing.T) {
+	release := make(chan bool)
+	var lock sync.Mutex
+	sent := make(map[string][]string)
+	dispatcher := NewDispatcher()
+	dispatcher.ChannelInterval = 0
+	dispatcher.global = NewRateLimiter(0)
+	dispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		if channelId == "slow" {
+			<-release
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		sent[channelId] = append(sent[channelId], body.Content)
+		return model.MessageResponseBody{}, nil
+	}
+
+	// the first message is being sent, the outbox is full after the next ones
+	const messages = OutboxSize + 3
+	dispatched := make(chan bool, messages)
+	go func() {
+		for i := 0; i < messages; i++ {
+			dispatched <- dispatcher.Dispatch(OutgoingMessage{ChannelId: "slow", Body: model.MessageSendBody{Content: fmt.Sprint(i)}})
+		}
+	}()
+	for i := 0; i < OutboxSize+1; i++ {
+		if !<-dispatched {
+			t.Fatalf("message %d should be queued", i)
+		}
+	}
+	select {
+	case <-dispatched:
+		t.Fatalf("message should wait for room in the full outbox")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	done := make(chan bool)
+	dispatcher.Dispatch(OutgoingMessage{
+		ChannelId: "fast",
+		OnSent:    func(model.MessageResponseBody, error) { close(done) },
+	})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("other channels should not wait for the full outbox")
+	}
+
+	close(release)
+	for i := OutboxSize + 1; i < messages; i++ {
+		if !<-dispatched {
+			t.Fatalf("message %d should be queued once there is room", i)
+		}
+	}
+	deadline := time.After(time.Second)
+	for {
+		lock.Lock()
+		count := len(sent["slow"])
+		lock.Unlock()
+		if count == messages {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("only %d messages sent", count)
+		case <-time.After(time.Millisecond):
+		}
+	}
+	for i, content := range sent["slow"] {
+		if content != fmt.Sprint(i) {
+			t.Fatalf("message %s sent at position %d", content, i)
+		}
+	}
+}
+
+func TestDispatchGivesUpAfterTimeout(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	dispatcher := NewDispatcher()
+	dispatcher.DispatchTimeout = 20 * time.Millisecond
+	dispatcher.global = NewRateLimiter(0)
+	dispatcher.Send = func(string, *model.MessageSendBody) (model.MessageResponseBody, error) {
+		<-release
+		return model.MessageResponseBody{}, nil
+	}
+	for i := 0; i < OutboxSize+1; i++ {
+		dispatcher.Dispatch(OutgoingMessage{ChannelId: "channel"})
+	}
+	if dispatcher.Dispatch(OutgoingMessage{ChannelId: "channel"}) {
+		t.Fatalf("message should be dropped once the outbox stays full")
+	}
+}
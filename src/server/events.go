@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"halligalli/game"
+	"halligalli/model"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// EventMetrics is notified of every dispatched event, it may be called concurrently
+type EventMetrics interface {
+	// EventHandled is called after the handler returns, err is non nil if parsing
+	// or handling failed or if the handler panicked
+	EventHandled(intent model.IntentType, elapsed time.Duration, err error)
+	EventUnknown(intent model.IntentType)
+}
+
+type eventHandler func(body json.RawMessage) error
+
+// EventDispatcher calls the handler registered for the intent of each dispatched event,
+// it is shared by the gateway and the webhook so that neither knows about event types
+type EventDispatcher struct {
+	Metrics  EventMetrics
+	lock     sync.RWMutex
+	handlers map[model.IntentType]eventHandler
+}
+
+func NewEventDispatcher() *EventDispatcher {
+	return &EventDispatcher{
+		handlers: make(map[model.IntentType]eventHandler),
+	}
+}
+
+// On registers the handler of an intent, replacing the previous one, the payload is parsed
+// into the type expected by the handler before it is called
+func On[T any](dispatcher *EventDispatcher, intent model.IntentType,
+	parse func(json.RawMessage) (T, error), handle func(T) error) {
+	dispatcher.lock.Lock()
+	defer dispatcher.lock.Unlock()
+	dispatcher.handlers[intent] = func(body json.RawMessage) error {
+		payload, err := parse(body)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", intent, err)
+		}
+		return handle(payload)
+	}
+}
+
+// RawBody is the parser of events whose payload is not needed
+func RawBody(body json.RawMessage) (json.RawMessage, error) {
+	return body, nil
+}
+
+// Dispatch handles the event, unknown events are logged and ignored
+func (dispatcher *EventDispatcher) Dispatch(intent model.IntentType, body json.RawMessage) (err error) {
+	dispatcher.lock.RLock()
+	handler, ok := dispatcher.handlers[intent]
+	dispatcher.lock.RUnlock()
+	if !ok {
+		slog.Info("unhandled event", "intent", intent)
+		if dispatcher.Metrics != nil {
+			dispatcher.Metrics.EventUnknown(intent)
+		}
+		return nil
+	}
+
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.Error("panic handling event", "intent", intent, "panic", recovered, "stack", string(debug.Stack()))
+			err = fmt.Errorf("panic handling %s: %v", intent, recovered)
+		}
+		if dispatcher.Metrics != nil {
+			dispatcher.Metrics.EventHandled(intent, time.Since(start), err)
+		}
+	}()
+	return handler(body)
+}
+
+// NewGameEventDispatcher registers the events shared by every delivery mode
+func NewGameEventDispatcher(eventChannel chan game.Event) *EventDispatcher {
+	dispatcher := NewEventDispatcher()
+	handleMessage := func(body model.MessageCreateBody) error {
+		return HandleMessageCreate(body, eventChannel)
+	}
+	On(dispatcher, model.MessageCreate, model.ParseMessageCreateResponseBody, handleMessage)
+	On(dispatcher, model.AtMessageCreate, model.ParseMessageCreateResponseBody, handleMessage)
+	On(dispatcher, model.GuildCreate, model.ParseGuildBody, func(guild model.GuildBody) error {
+		slog.Info("joined guild", "guild", guild.Name, "id", guild.Id, "members", guild.MemberCount)
+		return nil
+	})
+	On(dispatcher, model.GuildDelete, model.ParseGuildBody, func(guild model.GuildBody) error {
+		slog.Info("left guild", "guild", guild.Name, "id", guild.Id)
+		return nil
+	})
+	On(dispatcher, model.MessageReactionAdd, model.ParseMessageReactionBody, func(reaction model.MessageReactionBody) error {
+		return HandleMessageReaction(reaction, eventChannel)
+	})
+	On(dispatcher, model.MessageReactionRemove, model.ParseMessageReactionBody, func(reaction model.MessageReactionBody) error {
+		slog.Info("reaction removed", "emoji", reaction.Emoji.Id, "user", reaction.UserId, "message", reaction.Target.Id)
+		return nil
+	})
+	On(dispatcher, model.InteractionCreate, model.ParseInteractionBody, func(interaction model.InteractionBody) error {
+		return HandleInteraction(interaction, eventChannel)
+	})
+	return dispatcher
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"halligalli/model"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+type countingMetrics struct {
+	lock    sync.Mutex
+	handled map[model.IntentType]int
+	failed  map[model.IntentType]int
+	unknown map[model.IntentType]int
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		handled: make(map[model.IntentType]int),
+		failed:  make(map[model.IntentType]int),
+		unknown: make(map[model.IntentType]int),
+	}
+}
+
+func (metrics *countingMetrics) EventHandled(intent model.IntentType, _ time.Duration, err error) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.handled[intent] += 1
+	if err != nil {
+		metrics.failed[intent] += 1
+	}
+}
+
+func (metrics *countingMetrics) EventUnknown(intent model.IntentType) {
+	metrics.lock.Lock()
+	defer metrics.lock.Unlock()
+	metrics.unknown[intent] += 1
+}
+
+func TestEventDispatcherParsesPayloads(t *testing.T) {
+	dispatcher := NewEventDispatcher()
+	metrics := newCountingMetrics()
+	dispatcher.Metrics = metrics
+	var reactions []model.MessageReactionBody
+	On(dispatcher, model.MessageReactionAdd, model.ParseMessageReactionBody, func(reaction model.MessageReactionBody) error {
+		reactions = append(reactions, reaction)
+		return nil
+	})
+
+	body := json.RawMessage(`{"user_id":"player","channel_id":"channel","target":{"id":"message","type":0},"emoji":{"id":"128276","type":2}}`)
+	if err := dispatcher.Dispatch(model.MessageReactionAdd, body); err != nil {
+		t.Fatal(err)
+	}
+	if len(reactions) != 1 || reactions[0].Target.Id != "message" || reactions[0].Emoji.Id != "128276" {
+		t.Fatalf("unexpected reactions %+v", reactions)
+	}
+	if err := dispatcher.Dispatch(model.MessageReactionAdd, json.RawMessage(`[]`)); err == nil {
+		t.Fatalf("invalid payload should fail")
+	}
+	if err := dispatcher.Dispatch(model.GuildCreate, json.RawMessage(`{}`)); err != nil {
+		t.Fatalf("unknown events should be ignored, got %v", err)
+	}
+	if metrics.handled[model.MessageReactionAdd] != 2 || metrics.failed[model.MessageReactionAdd] != 1 ||
+		metrics.unknown[model.GuildCreate] != 1 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
+
+func TestEventDispatcherRecoversFromPanics(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	dispatcher := NewEventDispatcher()
+	metrics := newCountingMetrics()
+	dispatcher.Metrics = metrics
+	On(dispatcher, model.GuildCreate, model.ParseGuildBody, func(model.GuildBody) error {
+		panic("broken handler")
+	})
+	On(dispatcher, model.GuildDelete, model.ParseGuildBody, func(model.GuildBody) error {
+		return errors.New("failed")
+	})
+
+	if err := dispatcher.Dispatch(model.GuildCreate, json.RawMessage(`{}`)); err == nil {
+		t.Fatalf("panic should be reported as an error")
+	}
+	if err := dispatcher.Dispatch(model.GuildDelete, json.RawMessage(`{}`)); err == nil {
+		t.Fatalf("handler error should be returned")
+	}
+	if metrics.failed[model.GuildCreate] != 1 || metrics.failed[model.GuildDelete] != 1 {
+		t.Fatalf("unexpected metrics %+v", metrics)
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/storage"
+	"log/slog"
+)
+
+// ShowGuildKey is the message showing the settings of a guild
+const ShowGuildKey = "show_guild"
+
+// GuildConfig changes a setting shared by the channels of a guild, such as "config locale en guild"
+type GuildConfig struct {
+	Key   string
+	Value string
+}
+
+// SetGuildSetting changes a setting of the guild, only the locale can be shared
+func SetGuildSetting(guildId string, key string, value string) (storage.GuildSettings, error) {
+	if key != "locale" && key != "语言" {
+		return storage.GuildSettings{}, &game.RuleError{Reason: game.UnknownRuleKey, Key: key, Value: value}
+	}
+	name, err := game.ParseLocale(value)
+	if err != nil {
+		return storage.GuildSettings{}, err
+	}
+	store := env.GetContext().Store
+	if store == nil || guildId == "" {
+		return storage.GuildSettings{}, &game.RuleError{Reason: game.InvalidRuleValue, Key: "locale", Value: value}
+	}
+	guild, _, err := store.GetGuild(guildId)
+	if err != nil {
+		return storage.GuildSettings{}, err
+	}
+	guild.Id = guildId
+	guild.Locale = name
+	return guild, store.SaveGuild(guild)
+}
+
+// ConfigureGuild changes the setting of the guild and replies with the settings or why they cannot be changed
+func ConfigureGuild(reply game.ReplyContext, config GuildConfig) {
+	guild, err := SetGuildSetting(reply.GuildId, config.Key, config.Value)
+	name := locale.Resolve("", reply.GuildId)
+	if err != nil {
+		ruleError := &game.RuleError{Reason: game.InvalidRuleValue, Key: config.Key, Value: config.Value}
+		errors.As(err, &ruleError)
+		SendText(reply, WriteMessage(game.Message{MessageType: game.InvalidRule, ReplyContext: reply, Param: *ruleError}, name))
+		return
+	}
+	content, err := RenderKey(ShowGuildKey, MessageData{Param: guild}, name)
+	if err != nil {
+		slog.Error("writing message", "key", ShowGuildKey, "locale", name, "err", err)
+		content = fmt.Sprintf("[%s] %s", ShowGuildKey, guild.Locale)
+	}
+	SendText(reply, content)
+}
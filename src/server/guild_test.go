@@ -0,0 +1,64 @@
+package server
+
+import (
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"halligalli/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuildLocaleIsChangedOutsideTheGame(t *testing.T) {
+	loadCatalog(t)
+	store, err := storage.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := env.GetContext()
+	previousStore, previousUser, previousDispatcher := context.Store, context.User, DefaultDispatcher
+	context.Store, context.User = store, model.User{Id: "bot"}
+	sent := make(chan model.MessageSendBody, 4)
+	DefaultDispatcher = NewDispatcher()
+	DefaultDispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		sent <- *body
+		return model.MessageResponseBody{}, nil
+	}
+	defer func() {
+		context.Store, context.User, DefaultDispatcher = previousStore, previousUser, previousDispatcher
+	}()
+
+	// no game event is sent, so a running game cannot lock the setting
+	eventChannel := make(chan game.Event)
+	config := func(content string) model.MessageSendBody {
+		message := model.MessageCreateBody{Id: content, GuildId: "guild", ChannelId: "channel",
+			Content: "<@!bot> " + content, Mentions: []model.User{{Id: "bot"}}}
+		if err := HandleMessageCreate(message, eventChannel); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case body := <-sent:
+			return body
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no reply to %q", content)
+		}
+		return model.MessageSendBody{}
+	}
+
+	if body := config("config locale en guild"); !strings.Contains(body.Content, "guild") || body.ReplyMessageId == "" {
+		t.Fatalf("guild setting should be shown in the new locale, got %+v", body)
+	}
+	if guild, ok, _ := store.GetGuild("guild"); !ok || guild.Locale != "en" {
+		t.Fatalf("guild locale should be saved, got %+v %t", guild, ok)
+	}
+	if body := config("config locale fr guild"); !strings.Contains(body.Content, `"fr"`) {
+		t.Fatalf("unknown locale should be refused, got %+v", body)
+	}
+	if body := config("config window 3 guild"); !strings.Contains(body.Content, `"window"`) {
+		t.Fatalf("only the locale can be shared by the guild, got %+v", body)
+	}
+	if guild, _, _ := store.GetGuild("guild"); guild.Locale != "en" {
+		t.Fatalf("refused settings should leave the guild alone, got %+v", guild)
+	}
+}
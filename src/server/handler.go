@@ -2,68 +2,97 @@ package server
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/gorilla/websocket"
-	"halligalli/assets"
 	"halligalli/auth"
-	"halligalli/common"
 	"halligalli/env"
 	"halligalli/game"
+	"halligalli/locale"
 	"halligalli/model"
-	"log"
-	"strings"
+	"log/slog"
 	"time"
 )
 
-func HandleHelloResponse(body json.RawMessage) (*time.Ticker, error) {
+func HandleHelloResponse(body json.RawMessage, sessionId string, lastMessageId int) (*time.Ticker, error) {
 	helloResp, err := model.ParseHelloResponseBody(body)
 	if err != nil {
-		log.Println("ERROR parsing response body:", err)
+		slog.Error("parsing response body", "err", err)
 		return nil, err
 	}
 	// set heartbeat ticker
 	ticker := time.NewTicker(time.Duration(helloResp.HeartbeatInterval) * time.Millisecond)
 
-	// send identify message
+	// resume the previous session if there is one, otherwise identify as a new session
+	if sessionId != "" {
+		err = SendResume(sessionId, lastMessageId)
+	} else {
+		err = SendIdentify()
+	}
+	if err != nil {
+		ticker.Stop()
+		return nil, err
+	}
+	return ticker, nil
+}
+
+func SendIdentify() error {
+	token, err := auth.GetAuthorization(env.GetContext().Token)
+	if err != nil {
+		slog.Error("getting authorization", "err", err)
+		return err
+	}
 	identifyReq := model.IdentifyBody{
-		Token:      auth.GetTokenString(env.GetContext().Token),
-		Intents:    model.Intents,
-		Shard:      [2]int{0, 1},
+		Token:      token,
+		Intents:    env.GetContext().Delivery.Intents,
+		Shard:      env.GetContext().Delivery.Shard,
 		Properties: map[string]string{},
 	}
 	req, err := model.BuildRequest(model.Identify, identifyReq).GetString()
 	if err != nil {
-		log.Println("ERROR building request:", err)
-		return nil, err
+		slog.Error("building request", "err", err)
+		return err
 	}
-	log.Printf("authenticate: %s", req)
+	slog.Debug("authenticate", "request", req)
 	err = env.GetContext().Connection.WriteMessage(websocket.TextMessage, req)
 	if err != nil {
-		log.Println("ERROR sending message:", err)
-		return nil, err
+		slog.Error("sending message", "err", err)
+		return err
 	}
-	return ticker, nil
+	return nil
 }
 
-func HandleReadyResponse(body json.RawMessage) error {
-	readyResp, err := model.ParseReadyResponseBody(body)
+func SendResume(sessionId string, lastMessageId int) error {
+	token, err := auth.GetAuthorization(env.GetContext().Token)
 	if err != nil {
-		log.Println("ERROR parsing response body:", err)
+		slog.Error("getting authorization", "err", err)
 		return err
 	}
-	env.GetContext().User = readyResp.User
-	log.Printf("logged in as user %s %s, session id: %s",
-		readyResp.User.UserName, readyResp.User.Id, readyResp.SessionId)
-	return nil
-}
-
-func HandleMessageCreateResponse(body json.RawMessage, eventChannel chan game.Event) error {
-	messageCreateBody, err := model.ParseMessageCreateResponseBody(body)
+	resumeReq := model.ResumeBody{
+		Token:     token,
+		SessionId: sessionId,
+		Seq:       lastMessageId,
+	}
+	req, err := model.BuildRequest(model.Resume, resumeReq).GetString()
+	if err != nil {
+		slog.Error("building request", "err", err)
+		return err
+	}
+	slog.Debug("resume", "request", req)
+	err = env.GetContext().Connection.WriteMessage(websocket.TextMessage, req)
 	if err != nil {
-		log.Println("ERROR parsing response body:", err)
+		slog.Error("sending message", "err", err)
 		return err
 	}
+	return nil
+}
+
+// HandleReadyResponse returns the session id to be used when resuming
+func HandleReadyResponse(readyResp model.ReadyBody) string {
+	env.GetContext().User = readyResp.User
+	slog.Info("logged in", "user", readyResp.User.UserName, "id", readyResp.User.Id, "session", readyResp.SessionId)
+	return readyResp.SessionId
+}
 
+func HandleMessageCreate(messageCreateBody model.MessageCreateBody, eventChannel chan game.Event) error {
 	hasBotMentioned := false
 	for _, mention := range messageCreateBody.Mentions {
 		if mention.Id == env.GetContext().User.Id {
@@ -75,162 +104,73 @@ func HandleMessageCreateResponse(body json.RawMessage, eventChannel chan game.Ev
 		return nil
 	}
 
-	env.GetContext().ReplyMessageId = messageCreateBody.Id
-	if strings.Contains(messageCreateBody.Content, "game") {
-		eventChannel <- game.Event{
-			EventType: game.Initiate,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     nil,
-		}
-	} else if strings.Contains(messageCreateBody.Content, "start") {
-		eventChannel <- game.Event{
-			EventType: game.Start,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     nil,
-		}
-	} else if strings.Contains(messageCreateBody.Content, "continue") {
-		eventChannel <- game.Event{
-			EventType: game.Continue,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     nil,
-		}
-	} else if strings.Contains(messageCreateBody.Content, "stop") {
-		eventChannel <- game.Event{
-			EventType: game.Terminate,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     nil,
-		}
-	} else if strings.Contains(messageCreateBody.Content, "why") ||
-		strings.Contains(messageCreateBody.Content, "debug") {
-		eventChannel <- game.Event{
-			EventType: game.Debug,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     nil,
-		}
-	} else {
-		eventChannel <- game.Event{
-			EventType: game.RingTheBell,
-			ChannelId: messageCreateBody.ChannelId,
-			Param:     messageCreateBody.Author,
-		}
+	DefaultReplyQuota.Track(messageCreateBody.Id, time.Now())
+	event, err := BuildCommandEvent(messageCreateBody)
+	if err != nil {
+		slog.Info("ignored message", "err", err)
+		return nil
 	}
+	// guild settings are not part of any game, so they are changed even while a game is running
+	if config, ok := event.Param.(GuildConfig); ok {
+		ConfigureGuild(event.ReplyContext, config)
+		return nil
+	}
+	eventChannel <- event
 	return nil
 }
 
+// HandleGameMessage sends the messages of a game until the game closes its channel
 func HandleGameMessage(messageChannel chan game.Message) {
-	for {
-		select {
-		case message := <-messageChannel:
-			var messageBody model.MessageSendBody
-			switch message.MessageType {
-			case game.ShowGameRule:
-				messageBody = model.MessageSendBody{
-					Content: "欢迎来到 HalliGalli 小游戏！\n" +
-						"接下来我会依次翻开带有水果或动物图案的牌，如果在翻开的最后 5 张牌中有 5 个相同的水果或者含有动物牌，" +
-						"请立即发送一条 @我 的消息表示您按响了铃铛！\n" +
-						"第一个按响铃铛的玩家会赢下本轮，并由我重新发牌。小心不要按错了哦！\n" +
-						"准备好了吗？请 @我 发送 \"start\" 来开始游戏！",
-				}
-			case game.CardRevealed:
-				card := message.Param.(common.Card)
-				messageBody = model.MessageSendBody{
-					ImageUrl: card.Image,
-				}
-			case game.PlayerWin:
-				roundStatus := message.Param.(game.RoundStatus)
-				mentionPlayer := fmt.Sprintf("<@!%s>", roundStatus.Player.Id)
-				var reason string
-				if roundStatus.FruitName != "" {
-					reason = fmt.Sprintf(" 5 个%s", roundStatus.FruitName)
-				} else if roundStatus.AnimalName != "" {
-					reason = fmt.Sprintf("%s", roundStatus.AnimalName)
-				}
-				messageBody = model.MessageSendBody{
-					Content: fmt.Sprintf("恭喜%s赢得了这一轮！\n（最后五张牌中有%s）\n准备好清空桌面！@我 发送 continue 开始新的一轮！",
-						mentionPlayer, reason),
-				}
-			case game.FakeRing:
-				roundStatus := message.Param.(game.RoundStatus)
-				atPlayer := fmt.Sprintf("<@!%s>", roundStatus.Player.Id)
-				messageBody = model.MessageSendBody{
-					Content: atPlayer + "非常遗憾！桌面上并不满足按铃的条件！\n不要灰心丧气！重整旗鼓，@我 发送 continue 继续游戏！",
-				}
-			case game.Terminated:
-				messageBody = model.MessageSendBody{
-					Content: "游戏告一段落啦！想要再来一局，请随时 @我 发送 game 哦！",
-				}
-			case game.ExplainWhy:
-				validCards := message.Param.([]common.Card)
-				messageBody = model.MessageSendBody{
-					Content: BuildExplainMessage(validCards),
-				}
-			}
-			messageBody.ReplyMessageId = env.GetContext().ReplyMessageId
-			err := SendMessage(message.ChannelId, &messageBody)
-			if err != nil {
-				log.Println("ERROR sending message", err)
-				continue
-			}
+	for message := range messageChannel {
+		name := locale.Resolve(message.Rule.Locale, message.GuildId)
+		content := WriteMessage(message, name)
+		messageBody := model.MessageSendBody{Content: content}
+		onSent := LogSendError
+		var prepare func(body *model.MessageSendBody)
+		// fallbackText replaces the image of the message if it cannot be sent
+		var fallbackText string
+		if message.MessageType == game.CardRevealed {
+			revealed := message.Param.(game.RevealedCard)
+			messageBody, prepare, fallbackText = BuildCardMessage(revealed, content)
+			onSent = LinkCardMessage(message.ReplyContext, revealed)
+		}
+		// fall back to an active message once the passive reply is no longer available
+		if DefaultReplyQuota.Acquire(message.MessageId) {
+			messageBody.ReplyMessageId = message.MessageId
+		}
+		outgoing := OutgoingMessage{
+			ChannelId: message.ChannelId,
+			Body:      messageBody,
+			Prepare:   prepare,
+			OnSent:    onSent,
+		}
+		if fallbackText != "" {
+			outgoing.Fallback = TextFallback(messageBody, fallbackText)
+		} else if AttachKeyboard(&outgoing.Body, message.MessageType, name) {
+			// the plain text is sent instead if the bot is not allowed to send Markdown or keyboards
+			outgoing.Fallback = &messageBody
+		}
+		if !DefaultDispatcher.Dispatch(outgoing) {
+			slog.Error("outbox stayed full, dropped message", "channel", message.ChannelId, "type", message.MessageType)
 		}
 	}
 }
 
-func BuildExplainMessage(validCards []common.Card) string {
-	fruitCounter := make(map[int]int)
-	animalCounter := make([]int, 0)
-	var builder strings.Builder
-	for index, card := range validCards {
-		builder.WriteString(fmt.Sprintf("第%d张牌中", index))
-		if card.Type == common.Animal {
-			animalCounter = append(animalCounter, card.Variant)
-			builder.WriteString(fmt.Sprintf("有一只%s", assets.GetAnimalNameByVariant(card.Variant)))
-		} else if card.Type == common.Fruit {
-			if len(card.Elements) == 0 {
-				builder.WriteString("什么都没有")
-			}
-			firstFlag := true
-			for _, fruit := range card.Elements {
-				fruitCounter[fruit.Variant] += fruit.Number
-				if firstFlag {
-					firstFlag = false
-					builder.WriteString("有")
-				} else {
-					builder.WriteString("、")
-				}
-				builder.WriteString(fmt.Sprintf("%d个%s", fruit.Number,
-					assets.GetFruitNameByVariant(fruit.Variant)))
-			}
-		}
-		builder.WriteString("\n")
+// SendText sends a message that belongs to no game, without waiting for the outbox of the channel
+func SendText(reply game.ReplyContext, content string) {
+	body := model.MessageSendBody{Content: content}
+	if DefaultReplyQuota.Acquire(reply.MessageId) {
+		body.ReplyMessageId = reply.MessageId
 	}
-	builder.WriteString("总计")
-	if len(fruitCounter) == 0 {
-		builder.WriteString("没有水果")
-	} else {
-		firstFlag := true
-		for variant, number := range fruitCounter {
-			if firstFlag {
-				firstFlag = false
-				builder.WriteString("有")
-			} else {
-				builder.WriteString("、")
-			}
-			builder.WriteString(fmt.Sprintf("%d个%s", number, assets.GetFruitNameByVariant(variant)))
-		}
-	}
-	builder.WriteString("，")
-	if len(animalCounter) == 0 {
-		builder.WriteString("没有动物")
-	} else {
-		firstFlag := true
-		for _, variant := range animalCounter {
-			if firstFlag {
-				firstFlag = false
-			} else {
-				builder.WriteString("、")
-			}
-			builder.WriteString(fmt.Sprintf("一只%s", assets.GetAnimalNameByVariant(variant)))
+	go func() {
+		if !DefaultDispatcher.Dispatch(OutgoingMessage{ChannelId: reply.ChannelId, Body: body, OnSent: LogSendError}) {
+			slog.Error("outbox stayed full, dropped text", "channel", reply.ChannelId, "text", content)
 		}
+	}()
+}
+
+func LogSendError(_ model.MessageResponseBody, err error) {
+	if err != nil {
+		slog.Error("sending message", "err", err)
 	}
-	return builder.String()
 }
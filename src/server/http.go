@@ -6,59 +6,71 @@ import (
 	"halligalli/env"
 	"io"
 	"net/http"
+	"time"
 )
 
-func HttpGet(endpoint string) ([]byte, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", env.Url(endpoint), nil)
+// HttpTimeout bounds a single request to the OpenAPI, a message that timed out is retried as a network failure
+const HttpTimeout = 10 * time.Second
+
+// httpClient is shared by the requests so that their connections are reused
+var httpClient = &http.Client{Timeout: HttpTimeout}
+
+type HttpResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// HttpRequest sends an authorized request to the OpenAPI and returns the response
+// whatever its status code is
+func HttpRequest(method string, endpoint string, contentType string, reqBody []byte) (HttpResponse, error) {
+	var reader io.Reader
+	if reqBody != nil {
+		reader = bytes.NewReader(reqBody)
+	}
+	req, err := http.NewRequest(method, env.Url(endpoint), reader)
 	if err != nil {
-		return nil, err
+		return HttpResponse{}, err
 	}
 
-	token := env.GetContext().Token
-	req.Header.Set("Authorization", auth.GetTokenString(token))
-	resp, err := client.Do(req)
+	authorization, err := auth.GetAuthorization(env.GetContext().Token)
 	if err != nil {
-		return nil, err
+		return HttpResponse{}, err
+	}
+	req.Header.Set("Authorization", authorization)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return HttpResponse{}, err
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return HttpResponse{}, err
 	}
 
 	err = resp.Body.Close()
 	if err != nil {
-		return nil, err
+		return HttpResponse{}, err
 	}
 
-	return body, nil
+	return HttpResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
 }
 
-func HttpPost(endpoint string, reqBody []byte) ([]byte, error) {
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", env.Url(endpoint), bytes.NewReader(reqBody))
-	if err != nil {
-		return nil, err
-	}
-
-	token := env.GetContext().Token
-	req.Header.Set("Authorization", auth.GetTokenString(token))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	respBody, err := io.ReadAll(resp.Body)
+func HttpGet(endpoint string) ([]byte, error) {
+	resp, err := HttpRequest("GET", endpoint, "", nil)
 	if err != nil {
 		return nil, err
 	}
+	return resp.Body, nil
+}
 
-	err = resp.Body.Close()
+func HttpPost(endpoint string, reqBody []byte) ([]byte, error) {
+	resp, err := HttpRequest("POST", endpoint, "application/json", reqBody)
 	if err != nil {
 		return nil, err
 	}
-
-	return respBody, nil
+	return resp.Body, nil
 }
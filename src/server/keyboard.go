@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/model"
+	"log/slog"
+)
+
+// UnsupportedButtonKey is the message shown by clients that cannot press a button
+const UnsupportedButtonKey = "unsupported_button"
+
+// buttons send the name of a command when pressed, so that they share the command table with text messages
+var (
+	StartButton    = NewButton("start", "开始", model.ButtonBlue)
+	RingButton     = NewButton("ring", "🔔 按铃", model.ButtonBlue)
+	ContinueButton = NewButton("continue", "继续", model.ButtonBlue)
+	StopButton     = NewButton("stop", "停止", model.ButtonGrey)
+	WhyButton      = NewButton("why", "为什么", model.ButtonGrey)
+)
+
+// Keyboards are the controls offered along with each game message
+var Keyboards = map[game.MessageType]*model.Keyboard{
+	game.ShowGameRule:     NewKeyboard(StartButton),
+	game.ShowRoster:       NewKeyboard(StartButton),
+	game.NotEnoughPlayers: NewKeyboard(StartButton),
+	game.CardRevealed:     NewKeyboard(RingButton, StopButton),
+	game.PlayerWin:        NewKeyboard(ContinueButton, WhyButton, StopButton),
+	game.FakeRing:         NewKeyboard(ContinueButton, WhyButton, StopButton),
+}
+
+func NewButton(command string, label string, style int) model.Button {
+	return model.Button{
+		Id: command,
+		RenderData: model.ButtonRenderData{
+			Label:        label,
+			VisitedLabel: label,
+			Style:        style,
+		},
+		Action: model.ButtonAction{
+			Type:          model.ButtonCallback,
+			Permission:    model.ButtonPermission{Type: model.ButtonEveryone},
+			Data:          command,
+			UnsupportTips: fmt.Sprintf("请 @机器人 发送 %q", command),
+		},
+	}
+}
+
+func NewKeyboard(buttons ...model.Button) *model.Keyboard {
+	return &model.Keyboard{
+		Content: model.KeyboardContent{
+			Rows: []model.KeyboardRow{{Buttons: buttons}},
+		},
+	}
+}
+
+// AttachKeyboard turns the text message into a Markdown message with the controls of the message type,
+// labelled in the locale of the message. The OpenAPI only takes a keyboard along with Markdown, so messages
+// with an image are left alone. It returns false if no keyboard was attached
+func AttachKeyboard(body *model.MessageSendBody, messageType game.MessageType, name string) bool {
+	keyboard, ok := Keyboards[messageType]
+	if !ok || !env.GetContext().Keyboard || body.ImageUrl != "" || len(body.FileImage) > 0 {
+		return false
+	}
+	body.MsgType = model.MarkdownMessage
+	body.Markdown = &model.Markdown{Content: body.Content}
+	body.Content = ""
+	body.Keyboard = LocalizeKeyboard(keyboard, name)
+	return true
+}
+
+// LocalizeKeyboard copies the keyboard with the labels and tips of the locale, buttons without one keep theirs
+func LocalizeKeyboard(keyboard *model.Keyboard, name string) *model.Keyboard {
+	if keyboard == nil || locale.DefaultCatalog == nil {
+		return keyboard
+	}
+	localized := &model.Keyboard{}
+	for _, row := range keyboard.Content.Rows {
+		buttons := make([]model.Button, len(row.Buttons))
+		for index, button := range row.Buttons {
+			if label, ok := locale.DefaultCatalog.Button(name, button.Action.Data); ok {
+				button.RenderData.Label = label
+				button.RenderData.VisitedLabel = label
+			}
+			if tips, err := locale.DefaultCatalog.Render(name, UnsupportedButtonKey, button.Action.Data); err == nil {
+				button.Action.UnsupportTips = tips
+			}
+			buttons[index] = button
+		}
+		localized.Content.Rows = append(localized.Content.Rows, model.KeyboardRow{Buttons: buttons})
+	}
+	return localized
+}
+
+// BuildInteractionEvent turns a pressed button into the event of its command
+func BuildInteractionEvent(interaction model.InteractionBody) (game.Event, error) {
+	resolved := interaction.Data.Resolved
+	command, ok := FindCommand(resolved.ButtonData)
+	if !ok {
+		return game.Event{}, fmt.Errorf("unknown button %q", resolved.ButtonData)
+	}
+	// the parsers of the command table expect a message, buttons carry no message to reply to
+	return NewCommandEvent(command, nil, model.MessageCreateBody{
+		Author:    model.User{Id: resolved.UserId},
+		ChannelId: interaction.ChannelId,
+		GuildId:   interaction.GuildId,
+		Content:   resolved.ButtonData,
+		Timestamp: interaction.Timestamp,
+	})
+}
+
+// HandleInteraction acknowledges the button without blocking the events and feeds its command to the game
+func HandleInteraction(interaction model.InteractionBody, eventChannel chan game.Event) error {
+	event, err := BuildInteractionEvent(interaction)
+	code := model.InteractionSucceeded
+	if err != nil {
+		code = model.InteractionFailed
+	}
+	go func() {
+		if err := AcknowledgeInteraction(interaction.Id, code); err != nil {
+			slog.Error("acknowledging interaction", "interaction", interaction.Id, "err", err)
+		}
+	}()
+	if err != nil {
+		return err
+	}
+	eventChannel <- event
+	return nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newInteraction(id string, button string) model.InteractionBody {
+	return model.InteractionBody{
+		Id:        id,
+		ChannelId: "channel",
+		GuildId:   "guild",
+		Timestamp: "2023-11-06T13:37:18+08:00",
+		Data: model.InteractionData{
+			Resolved: model.InteractionResolved{ButtonData: button, ButtonId: button, UserId: "player"},
+		},
+	}
+}
+
+func TestInteractionIsAcknowledgedAndMapped(t *testing.T) {
+	acks := make(chan string, 2)
+	api := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		body, _ := io.ReadAll(request.Body)
+		acks <- request.Method + " " + request.URL.Path + " " + string(body)
+	}))
+	defer api.Close()
+	defer func(previous string) { env.Env = previous }(env.Env)
+	env.Env = api.URL
+
+	eventChannel := make(chan game.Event, 1)
+	received := time.Now()
+	if err := HandleInteraction(newInteraction("interaction-1", RingButton.Action.Data), eventChannel); err != nil {
+		t.Fatal(err)
+	}
+	event := <-eventChannel
+	ring, ok := event.Param.(game.Ring)
+	if event.EventType != game.RingTheBell || !ok || ring.Player.Id != "player" || event.ChannelId != "channel" ||
+		event.MessageId != "" || ring.Timestamp.Format(time.RFC3339) != "2023-11-06T13:37:18+08:00" || ring.ReceivedAt.Before(received) {
+		t.Fatalf("unexpected event %+v", event)
+	}
+	select {
+	case ack := <-acks:
+		if ack != `PUT /interactions/interaction-1 {"code":0}` {
+			t.Fatalf("unexpected acknowledgement %s", ack)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("interaction was not acknowledged")
+	}
+
+	if err := HandleInteraction(newInteraction("interaction-2", "unknown"), eventChannel); err == nil {
+		t.Fatalf("unknown button should fail")
+	}
+	if ack := <-acks; ack != `PUT /interactions/interaction-2 {"code":1}` {
+		t.Fatalf("unexpected acknowledgement %s", ack)
+	}
+}
+
+func TestEveryButtonMapsToItsCommand(t *testing.T) {
+	expected := map[string]game.EventType{
+		StartButton.Action.Data:    game.Start,
+		RingButton.Action.Data:     game.RingTheBell,
+		ContinueButton.Action.Data: game.Continue,
+		StopButton.Action.Data:     game.Terminate,
+		WhyButton.Action.Data:      game.Debug,
+	}
+	for data, eventType := range expected {
+		event, err := BuildInteractionEvent(newInteraction("interaction", data))
+		if err != nil || event.EventType != eventType {
+			t.Errorf("button %s should map to event %d, got %+v, %v", data, eventType, event, err)
+		}
+	}
+
+}
+
+func TestKeyboardIsSentWithMarkdown(t *testing.T) {
+	defer func(previous bool) { env.GetContext().Keyboard = previous }(env.GetContext().Keyboard)
+	env.GetContext().Keyboard = false
+	body := model.MessageSendBody{Content: "card"}
+	if AttachKeyboard(&body, game.CardRevealed, locale.English) || body.Keyboard != nil || body.MsgType != 0 {
+		t.Fatalf("keyboards should be off by default, got %+v", body)
+	}
+
+	env.GetContext().Keyboard = true
+	if !AttachKeyboard(&body, game.CardRevealed, locale.English) {
+		t.Fatalf("keyboard should be attached to a text message")
+	}
+	raw, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err = json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := decoded["content"]; ok || decoded["msg_type"] != float64(2) ||
+		decoded["markdown"].(map[string]any)["content"] != "card" {
+		t.Fatalf("keyboard should be sent along with a markdown body, got %s", raw)
+	}
+	rows := decoded["keyboard"].(map[string]any)["content"].(map[string]any)["rows"].([]any)
+	buttons := rows[0].(map[string]any)["buttons"].([]any)
+	if len(buttons) != 2 || buttons[0].(map[string]any)["action"].(map[string]any)["data"] != "ring" {
+		t.Fatalf("unexpected keyboard %s", raw)
+	}
+
+	image := model.MessageSendBody{ImageUrl: "card.png"}
+	if AttachKeyboard(&image, game.CardRevealed, locale.English) || image.Keyboard != nil || image.Markdown != nil {
+		t.Fatalf("messages with an image cannot carry a keyboard, got %+v", image)
+	}
+	score := model.MessageSendBody{Content: "score"}
+	if AttachKeyboard(&score, game.ShowScore, locale.English) || score.Content != "score" {
+		t.Fatalf("messages without controls should stay plain, got %+v", score)
+	}
+}
+
+func TestKeyboardIsLocalized(t *testing.T) {
+	loadCatalog(t)
+	keyboard := LocalizeKeyboard(Keyboards[game.PlayerWin], locale.English)
+	button := keyboard.Content.Rows[0].Buttons[0]
+	if button.RenderData.Label != "Continue" || button.Action.UnsupportTips != `Please mention the bot with "continue"` {
+		t.Fatalf("button should be written in english, got %+v", button)
+	}
+	if original := Keyboards[game.PlayerWin].Content.Rows[0].Buttons[0]; original.RenderData.Label != "继续" {
+		t.Fatalf("shared keyboard should be left alone, got %+v", original)
+	}
+}
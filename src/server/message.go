@@ -1,25 +1,125 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"halligalli/model"
-	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
 )
 
-func SendMessage(channelId string, body *model.MessageSendBody) error {
+// APIError is an error returned by the OpenAPI, Code and Message come from the JSON body
+type APIError struct {
+	StatusCode int
+	Code       int
+	Message    string
+	TraceId    string
+	// RetryAfter is the delay asked by the server, zero if it did not ask for one
+	RetryAfter time.Duration
+}
+
+func (err *APIError) Error() string {
+	return fmt.Sprintf("api error %d (status %d): %s, trace id %s", err.Code, err.StatusCode, err.Message, err.TraceId)
+}
+
+// Retryable reports whether sending again later may succeed, that is when rate limited or
+// when the server failed
+func (err *APIError) Retryable() bool {
+	return err.StatusCode == http.StatusTooManyRequests || err.StatusCode >= http.StatusInternalServerError
+}
+
+func NewAPIError(resp HttpResponse) *APIError {
+	apiError := &APIError{StatusCode: resp.StatusCode}
+	if body, err := model.ParseErrorBody(resp.Body); err == nil {
+		apiError.Code = body.Code
+		apiError.Message = body.Message
+		apiError.TraceId = body.TraceId
+	} else {
+		apiError.Message = string(resp.Body)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiError.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiError
+}
+
+func SendMessage(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
 	url := fmt.Sprintf("/channels/%s/messages", channelId)
 	bodyRaw, err := json.Marshal(body)
 	if err != nil {
-		return err
+		return model.MessageResponseBody{}, err
 	}
-	log.Printf("send: %s", bodyRaw)
+	slog.Debug("send", "body", bodyRaw)
 
-	respRaw, err := HttpPost(url, bodyRaw)
+	contentType := "application/json"
+	if len(body.FileImage) > 0 {
+		if contentType, bodyRaw, err = BuildMultipartMessage(body); err != nil {
+			return model.MessageResponseBody{}, err
+		}
+	}
+	resp, err := HttpRequest("POST", url, contentType, bodyRaw)
 	if err != nil {
-		return err
+		return model.MessageResponseBody{}, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return model.MessageResponseBody{}, NewAPIError(resp)
 	}
 
-	log.Printf("sending message response: %s", string(respRaw))
+	slog.Debug("sending message response", "body", resp.Body)
+	// the message has been sent even if its response cannot be parsed
+	response, err := model.ParseMessageResponseBody(resp.Body)
+	if err != nil {
+		slog.Error("parsing message response", "err", err)
+	}
+	return response, nil
+}
+
+// AcknowledgeInteraction tells the client that the button has been handled
+func AcknowledgeInteraction(interactionId string, code int) error {
+	bodyRaw, err := json.Marshal(model.InteractionAckBody{Code: code})
+	if err != nil {
+		return err
+	}
+	resp, err := HttpRequest("PUT", fmt.Sprintf("/interactions/%s", interactionId), "application/json", bodyRaw)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return NewAPIError(resp)
+	}
 	return nil
 }
+
+// BuildMultipartMessage puts the fields of the body in a form along with the image file,
+// messages with an image are not written in Markdown so they carry no keyboard
+func BuildMultipartMessage(body *model.MessageSendBody) (string, []byte, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+	fields := [][2]string{
+		{"content", body.Content},
+		{"msg_id", body.ReplyMessageId},
+	}
+	for _, field := range fields {
+		if field[1] == "" {
+			continue
+		}
+		if err := writer.WriteField(field[0], field[1]); err != nil {
+			return "", nil, err
+		}
+	}
+	file, err := writer.CreateFormFile("file_image", "board.png")
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err = file.Write(body.FileImage); err != nil {
+		return "", nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return "", nil, err
+	}
+	return writer.FormDataContentType(), buffer.Bytes(), nil
+}
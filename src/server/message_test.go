@@ -0,0 +1,41 @@
+package server
+
+import (
+	"bytes"
+	"halligalli/model"
+	"io"
+	"mime"
+	"mime/multipart"
+	"testing"
+)
+
+func TestBuildMultipartMessage(t *testing.T) {
+	body := &model.MessageSendBody{
+		ReplyMessageId: "message",
+		ImageUrl:       "ignored",
+		FileImage:      []byte("png"),
+	}
+	contentType, raw, err := BuildMultipartMessage(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(raw), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if form.Value["msg_id"][0] != "message" || len(form.Value["content"]) != 0 {
+		t.Fatalf("unexpected fields %+v", form.Value)
+	}
+	file, err := form.File["file_image"][0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if content, _ := io.ReadAll(file); string(content) != "png" {
+		t.Fatalf("unexpected file content %q", content)
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+const (
+	// PassiveReplyLimit is the number of replies allowed for a single user message
+	PassiveReplyLimit = 5
+	// PassiveReplyExpiry is how long a user message can be replied to
+	PassiveReplyExpiry = 5 * time.Minute
+)
+
+type passiveReply struct {
+	MessageId  string
+	ReceivedAt time.Time
+	Count      int
+}
+
+// replyHeap orders the tracked messages by receive time, so that the expired ones are found without a scan
+type replyHeap []*passiveReply
+
+func (replies replyHeap) Len() int {
+	return len(replies)
+}
+
+func (replies replyHeap) Less(i, j int) bool {
+	return replies[i].ReceivedAt.Before(replies[j].ReceivedAt)
+}
+
+func (replies replyHeap) Swap(i, j int) {
+	replies[i], replies[j] = replies[j], replies[i]
+}
+
+func (replies *replyHeap) Push(reply any) {
+	*replies = append(*replies, reply.(*passiveReply))
+}
+
+func (replies *replyHeap) Pop() any {
+	old := *replies
+	reply := old[len(old)-1]
+	*replies = old[:len(old)-1]
+	return reply
+}
+
+// ReplyQuota tracks how many passive replies each user message has left
+type ReplyQuota struct {
+	lock    sync.Mutex
+	replies map[string]*passiveReply
+	expiry  replyHeap
+	now     func() time.Time
+}
+
+var DefaultReplyQuota = NewReplyQuota()
+
+func NewReplyQuota() *ReplyQuota {
+	return &ReplyQuota{
+		replies: make(map[string]*passiveReply),
+		now:     time.Now,
+	}
+}
+
+func (quota *ReplyQuota) Track(messageId string, receivedAt time.Time) {
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+	quota.expire()
+	if _, ok := quota.replies[messageId]; !ok {
+		reply := &passiveReply{MessageId: messageId, ReceivedAt: receivedAt}
+		quota.replies[messageId] = reply
+		heap.Push(&quota.expiry, reply)
+	}
+}
+
+// expire forgets the messages that can no longer be replied to, oldest first
+func (quota *ReplyQuota) expire() {
+	now := quota.now()
+	for len(quota.expiry) > 0 && now.Sub(quota.expiry[0].ReceivedAt) > PassiveReplyExpiry {
+		reply := heap.Pop(&quota.expiry).(*passiveReply)
+		delete(quota.replies, reply.MessageId)
+	}
+}
+
+// Acquire counts a reply to the message, returns false if it has expired or hit the limit
+func (quota *ReplyQuota) Acquire(messageId string) bool {
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+	reply, ok := quota.replies[messageId]
+	if !ok || quota.now().Sub(reply.ReceivedAt) > PassiveReplyExpiry || reply.Count >= PassiveReplyLimit {
+		return false
+	}
+	reply.Count += 1
+	return true
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"halligalli/game"
+	"halligalli/model"
+	"testing"
+	"time"
+)
+
+func TestReplyQuotaLimitsRepliesPerMessage(t *testing.T) {
+	quota := NewReplyQuota()
+	quota.Track("message", time.Now())
+	for i := 0; i < PassiveReplyLimit; i++ {
+		if !quota.Acquire("message") {
+			t.Fatalf("reply %d should be passive", i)
+		}
+	}
+	if quota.Acquire("message") {
+		t.Fatalf("message should have no reply left")
+	}
+	quota.Track("message", time.Now())
+	if quota.Acquire("message") {
+		t.Fatalf("tracking the message again should not reset its replies")
+	}
+	quota.Track("other", time.Now())
+	if !quota.Acquire("other") || quota.Acquire("unknown") {
+		t.Fatalf("each tracked message should have its own replies")
+	}
+}
+
+func TestReplyQuotaExpires(t *testing.T) {
+	now := time.Now()
+	quota := NewReplyQuota()
+	quota.now = func() time.Time { return now }
+	quota.Track("old", now)
+	quota.Track("older", now.Add(-time.Minute))
+	quota.Track("new", now.Add(time.Minute))
+
+	now = now.Add(PassiveReplyExpiry + time.Second)
+	if quota.Acquire("old") || quota.Acquire("older") {
+		t.Fatalf("expired message should not be replied to")
+	}
+	if !quota.Acquire("new") {
+		t.Fatalf("recent message should still be replied to")
+	}
+
+	// expired messages are forgotten when the next one is tracked
+	quota.Track("next", now)
+	if len(quota.replies) != 2 || len(quota.expiry) != 2 || quota.replies["old"] != nil || quota.replies["older"] != nil {
+		t.Fatalf("only recent messages should be kept, got %v", quota.replies)
+	}
+}
+
+func TestRepliesFallBackToActiveMessages(t *testing.T) {
+	loadCatalog(t)
+	previousQuota, previousDispatcher := DefaultReplyQuota, DefaultDispatcher
+	defer func() { DefaultReplyQuota, DefaultDispatcher = previousQuota, previousDispatcher }()
+	DefaultReplyQuota = NewReplyQuota()
+	DefaultReplyQuota.Track("message", time.Now())
+	sent := make(chan model.MessageSendBody, PassiveReplyLimit+2)
+	DefaultDispatcher = NewDispatcher()
+	DefaultDispatcher.ChannelInterval = 0
+	DefaultDispatcher.global = NewRateLimiter(0)
+	DefaultDispatcher.Send = func(channelId string, body *model.MessageSendBody) (model.MessageResponseBody, error) {
+		sent <- *body
+		return model.MessageResponseBody{}, nil
+	}
+
+	messages := make(chan game.Message, PassiveReplyLimit+2)
+	for i := 0; i < PassiveReplyLimit+2; i++ {
+		messages <- game.Message{
+			MessageType:  game.ShowScore,
+			ReplyContext: game.ReplyContext{ChannelId: "channel", MessageId: "message"},
+			Param:        []game.PlayerScore{},
+		}
+	}
+	close(messages)
+	HandleGameMessage(messages)
+	for i := 0; i < PassiveReplyLimit+2; i++ {
+		select {
+		case body := <-sent:
+			passive := i < PassiveReplyLimit
+			if (body.ReplyMessageId == "message") != passive {
+				t.Fatalf("message %d should be passive: %t, got %+v", i, passive, body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %d was not sent", i)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"container/heap"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CardMessageExpiry is how long reactions to a card message are taken as rings,
+// rings on cards of an earlier round are ignored by the game anyway
+const CardMessageExpiry = 10 * time.Minute
+
+type cardMessage struct {
+	MessageId string
+	Reply     game.ReplyContext
+	Card      game.RevealedCard
+	SentAt    time.Time
+}
+
+// cardHeap orders the card messages by send time, so that the expired ones are found without a scan
+type cardHeap []*cardMessage
+
+func (messages cardHeap) Len() int {
+	return len(messages)
+}
+
+func (messages cardHeap) Less(i, j int) bool {
+	return messages[i].SentAt.Before(messages[j].SentAt)
+}
+
+func (messages cardHeap) Swap(i, j int) {
+	messages[i], messages[j] = messages[j], messages[i]
+}
+
+func (messages *cardHeap) Push(message any) {
+	*messages = append(*messages, message.(*cardMessage))
+}
+
+func (messages *cardHeap) Pop() any {
+	old := *messages
+	message := old[len(old)-1]
+	*messages = old[:len(old)-1]
+	return message
+}
+
+// CardMessages remembers which card each message sent by the bot shows
+type CardMessages struct {
+	lock     sync.Mutex
+	messages map[string]*cardMessage
+	expiry   cardHeap
+	now      func() time.Time
+}
+
+var DefaultCardMessages = NewCardMessages()
+
+func NewCardMessages() *CardMessages {
+	return &CardMessages{
+		messages: make(map[string]*cardMessage),
+		now:      time.Now,
+	}
+}
+
+func (cards *CardMessages) Link(messageId string, reply game.ReplyContext, card game.RevealedCard, sentAt time.Time) {
+	cards.lock.Lock()
+	defer cards.lock.Unlock()
+	cards.expire()
+	message := &cardMessage{MessageId: messageId, Reply: reply, Card: card, SentAt: sentAt}
+	cards.messages[messageId] = message
+	heap.Push(&cards.expiry, message)
+}
+
+// expire forgets the card messages that no longer ring the bell, oldest first
+func (cards *CardMessages) expire() {
+	now := cards.now()
+	for len(cards.expiry) > 0 && now.Sub(cards.expiry[0].SentAt) > CardMessageExpiry {
+		message := heap.Pop(&cards.expiry).(*cardMessage)
+		// the message may have been linked again since
+		if cards.messages[message.MessageId] == message {
+			delete(cards.messages, message.MessageId)
+		}
+	}
+}
+
+func (cards *CardMessages) Find(messageId string) (game.ReplyContext, game.RevealedCard, bool) {
+	cards.lock.Lock()
+	defer cards.lock.Unlock()
+	message, ok := cards.messages[messageId]
+	if !ok || cards.now().Sub(message.SentAt) > CardMessageExpiry {
+		return game.ReplyContext{}, game.RevealedCard{}, false
+	}
+	return message.Reply, message.Card, true
+}
+
+// LinkCardMessage keeps the id of the card message once it is sent
+func LinkCardMessage(reply game.ReplyContext, card game.RevealedCard) func(model.MessageResponseBody, error) {
+	return func(response model.MessageResponseBody, err error) {
+		LogSendError(response, err)
+		if err == nil && response.Id != "" {
+			DefaultCardMessages.Link(response.Id, reply, card, time.Now())
+		}
+	}
+}
+
+// HandleMessageReaction rings the bell for the player reacting to a card message
+func HandleMessageReaction(reaction model.MessageReactionBody, eventChannel chan game.Event) error {
+	if reaction.UserId == env.GetContext().User.Id {
+		return nil
+	}
+	reply, card, ok := DefaultCardMessages.Find(reaction.Target.Id)
+	if !ok {
+		slog.Info("ignored reaction", "user", reaction.UserId, "message", reaction.Target.Id)
+		return nil
+	}
+	eventChannel <- game.Event{
+		EventType:    game.RingTheBell,
+		ReplyContext: game.ReplyContext{GuildId: reply.GuildId, ChannelId: reply.ChannelId},
+		Param: game.Ring{
+			Player:     model.User{Id: reaction.UserId},
+			ReceivedAt: time.Now(),
+			Card:       &card,
+		},
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"testing"
+	"time"
+)
+
+func TestReactionToCardMessageRings(t *testing.T) {
+	env.GetContext().User = model.User{Id: "bot"}
+	eventChannel := make(chan game.Event, 1)
+	reply := game.ReplyContext{MessageId: "command", GuildId: "guild", ChannelId: "channel"}
+	card := game.RevealedCard{Card: common.Card{Type: common.Animal}, Round: 3}
+	LinkCardMessage(reply, card)(model.MessageResponseBody{Id: "card-message"}, nil)
+
+	reaction := model.MessageReactionBody{
+		UserId:    "player",
+		ChannelId: "channel",
+		Target:    model.ReactionTarget{Id: "card-message"},
+	}
+	if err := HandleMessageReaction(reaction, eventChannel); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-eventChannel:
+		ring := event.Param.(game.Ring)
+		if event.EventType != game.RingTheBell || event.ChannelId != "channel" || event.MessageId != "" ||
+			ring.Player.Id != "player" || ring.Card == nil || ring.Card.Round != 3 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("reaction should ring the bell")
+	}
+
+	// reactions to other messages and from the bot itself are ignored
+	reaction.Target.Id = "other-message"
+	_ = HandleMessageReaction(reaction, eventChannel)
+	reaction.Target.Id = "card-message"
+	reaction.UserId = "bot"
+	_ = HandleMessageReaction(reaction, eventChannel)
+	if len(eventChannel) != 0 {
+		t.Fatalf("unexpected ring %+v", <-eventChannel)
+	}
+}
+
+type noScheduler struct{}
+
+func (noScheduler) Schedule(string, game.TimerKind, time.Time) {}
+
+func (noScheduler) Cancel(string) {}
+
+func TestTextRingAndReactionRingCompete(t *testing.T) {
+	env.GetContext().User = model.User{Id: "bot"}
+	reply := game.ReplyContext{GuildId: "guild", ChannelId: "channel"}
+	card := game.RevealedCard{Card: common.Card{Type: common.Animal}, Round: 1}
+	LinkCardMessage(reply, card)(model.MessageResponseBody{Id: "card-message"}, nil)
+	text := model.MessageCreateBody{
+		Author:       model.User{Id: "texter"},
+		ChannelId:    "channel",
+		GuildId:      "guild",
+		Content:      "<@!bot>",
+		SeqInChannel: "1",
+	}
+	reaction := model.MessageReactionBody{UserId: "reactor", ChannelId: "channel", Target: model.ReactionTarget{Id: "card-message"}}
+
+	// the text is ranked by its server timestamp, the reaction by the second it was received in
+	tests := []struct {
+		name     string
+		sentIn   time.Duration
+		expected string
+	}{
+		{name: "text sent in an earlier second wins though received last", sentIn: -time.Second, expected: "texter"},
+		{name: "reaction received in an earlier second wins", sentIn: 2 * time.Second, expected: "reactor"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			eventChannel := make(chan game.Event, 2)
+			text.Timestamp = time.Now().Add(test.sentIn).Format(time.RFC3339)
+			_ = HandleMessageReaction(reaction, eventChannel)
+			event, err := BuildCommandEvent(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventChannel <- event
+
+			current := &game.Game{
+				ChannelId: "channel",
+				State:     game.Running,
+				Round:     1,
+				Roster:    []model.User{{Id: "texter"}, {Id: "reactor"}},
+			}
+			messageChannel := make(chan game.Message, 8)
+			for len(eventChannel) > 0 {
+				game.HandleEvent(current, <-eventChannel, noScheduler{}, messageChannel)
+			}
+			first, runnersUp := current.Arbitrate()
+			if first.Player.Id != test.expected || len(runnersUp) != 1 || runnersUp[0].Player.Id == test.expected {
+				t.Fatalf("%s should win, got %+v %+v", test.expected, first, runnersUp)
+			}
+		})
+	}
+}
+
+func TestCardMessagesExpire(t *testing.T) {
+	now := time.Now()
+	cards := NewCardMessages()
+	cards.now = func() time.Time { return now }
+	reply := game.ReplyContext{ChannelId: "channel"}
+	cards.Link("old", reply, game.RevealedCard{Round: 1}, now)
+	cards.Link("older", reply, game.RevealedCard{Round: 1}, now.Add(-time.Minute))
+	cards.Link("new", reply, game.RevealedCard{Round: 2}, now.Add(time.Minute))
+
+	now = now.Add(CardMessageExpiry + time.Second)
+	if _, _, ok := cards.Find("old"); ok {
+		t.Fatalf("expired card message should not ring")
+	}
+	if _, card, ok := cards.Find("new"); !ok || card.Round != 2 {
+		t.Fatalf("recent card message should still ring")
+	}
+
+	// expired card messages are forgotten when the next one is linked
+	cards.Link("next", reply, game.RevealedCard{Round: 3}, now)
+	if len(cards.messages) != 2 || len(cards.expiry) != 2 || cards.messages["old"] != nil || cards.messages["older"] != nil {
+		t.Fatalf("only recent card messages should be kept, got %v", cards.messages)
+	}
+}
@@ -5,18 +5,18 @@ import (
 	"github.com/gorilla/websocket"
 	"halligalli/env"
 	"halligalli/model"
-	"log"
+	"log/slog"
 )
 
 func GetWebsocketUrl() (string, error) {
 	bodyRaw, err := HttpGet("/gateway")
 	if err != nil {
-		log.Println("ERROR unable to get websocket url", err)
+		slog.Error("getting websocket url", "err", err)
 		return "", err
 	}
 	var gatewayResp model.GatewayBody
 	if err = json.Unmarshal(bodyRaw, &gatewayResp); err != nil {
-		log.Println("ERROR parsing gateway response", err)
+		slog.Error("parsing gateway response", "err", err)
 		return "", err
 	}
 	return gatewayResp.Url, nil
@@ -29,9 +29,26 @@ func ConnectToWebsocketServer() error {
 	}
 	connection, _, err := websocket.DefaultDialer.Dial(url, nil)
 	if err != nil {
-		log.Println("ERROR connecting to :", err)
+		slog.Error("connecting to websocket server", "err", err)
 		return err
 	}
 	env.GetContext().Connection = connection
 	return nil
 }
+
+// FetchBotUser loads the user of the bot, which is otherwise given by the ready event of the gateway
+func FetchBotUser() error {
+	bodyRaw, err := HttpGet("/users/@me")
+	if err != nil {
+		slog.Error("getting bot user", "err", err)
+		return err
+	}
+	var user model.User
+	if err = json.Unmarshal(bodyRaw, &user); err != nil {
+		slog.Error("parsing user response", "err", err)
+		return err
+	}
+	env.GetContext().User = user
+	slog.Info("logged in", "user", user.UserName, "id", user.Id)
+	return nil
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	MinReconnectBackoff = time.Second
+	MaxReconnectBackoff = time.Minute
+)
+
+// Supervisor owns the gateway connection and redials it whenever it is lost,
+// resuming the previous session so that running games are not affected
+type Supervisor struct {
+	SessionId     string
+	LastMessageId int
+	Events        *EventDispatcher
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+	// Connect dials the gateway and sets the connection of the context
+	Connect func() error
+	backoff time.Duration
+}
+
+func NewSupervisor(eventChannel chan game.Event) *Supervisor {
+	supervisor := &Supervisor{
+		LastMessageId: model.DefaultLastMessageId,
+		Events:        NewGameEventDispatcher(eventChannel),
+		MinBackoff:    MinReconnectBackoff,
+		MaxBackoff:    MaxReconnectBackoff,
+		Connect:       ConnectToWebsocketServer,
+	}
+	// the session events only exist on the gateway
+	On(supervisor.Events, model.Ready, model.ParseReadyResponseBody, func(body model.ReadyBody) error {
+		supervisor.SessionId = HandleReadyResponse(body)
+		supervisor.backoff = supervisor.MinBackoff
+		return nil
+	})
+	On(supervisor.Events, model.Resumed, RawBody, func(json.RawMessage) error {
+		slog.Info("session resumed", "session", supervisor.SessionId)
+		supervisor.backoff = supervisor.MinBackoff
+		return nil
+	})
+	return supervisor
+}
+
+// Run blocks until the interrupt signal is received
+func (supervisor *Supervisor) Run(interrupt chan os.Signal) {
+	supervisor.backoff = supervisor.MinBackoff
+	for {
+		err := supervisor.Connect()
+		if err == nil {
+			if supervisor.serve(env.GetContext().Connection, interrupt) {
+				return
+			}
+		} else {
+			slog.Error("connecting to websocket server", "err", err)
+		}
+
+		slog.Info("reconnecting", "backoff", supervisor.backoff)
+		select {
+		case <-time.After(supervisor.backoff):
+		case <-interrupt:
+			slog.Info("interrupted by user event")
+			return
+		}
+		supervisor.backoff = minDuration(supervisor.backoff*2, supervisor.MaxBackoff)
+	}
+}
+
+// serve handles a single connection, returns true if interrupted by user
+func (supervisor *Supervisor) serve(connection *websocket.Conn, interrupt chan os.Signal) bool {
+	stop := make(chan bool)
+	messages := make(chan []byte, 32)
+	defer func() {
+		close(stop)
+		if err := connection.Close(); err != nil {
+			slog.Error("closing connection", "err", err)
+		}
+	}()
+	go ReadMessages(connection, messages, stop)
+
+	heartbeatTicker := time.NewTicker(time.Duration(model.DefaultHeartbeatIntervalMillis) * time.Millisecond)
+	defer func() {
+		heartbeatTicker.Stop()
+	}()
+
+	for {
+		select {
+		case message, ok := <-messages:
+			if !ok {
+				slog.Info("connection lost")
+				return false
+			}
+			slog.Debug("receive", "body", message)
+			raw, err := model.GetOpType(message)
+			if err != nil {
+				slog.Error("getting operation type", "err", err)
+				continue
+			}
+			if raw.MessageId != model.DefaultLastMessageId {
+				supervisor.LastMessageId = raw.MessageId
+			}
+
+			switch raw.Op {
+			case model.Hello:
+				ticker, err := HandleHelloResponse(raw.Body, supervisor.SessionId, supervisor.LastMessageId)
+				if err != nil {
+					return false
+				}
+				heartbeatTicker.Stop()
+				heartbeatTicker = ticker
+			case model.HeartbeatAck:
+				slog.Debug("heartbeat acknowledged")
+			case model.Reconnect:
+				slog.Info("server requested reconnect")
+				return false
+			case model.InvalidSession:
+				// the session can still be resumed when d is true
+				var resumable bool
+				if err := json.Unmarshal(raw.Body, &resumable); err == nil && resumable {
+					slog.Info("session invalidated, resuming it", "session", supervisor.SessionId)
+					return false
+				}
+				slog.Info("session invalidated, identifying as a new session")
+				supervisor.SessionId = ""
+				supervisor.LastMessageId = model.DefaultLastMessageId
+				return false
+			case model.Dispatch:
+				if err := supervisor.Events.Dispatch(raw.Intent, raw.Body); err != nil {
+					slog.Error("handling event", "intent", raw.Intent, "err", err)
+				}
+			}
+		case <-heartbeatTicker.C:
+			var heartbeatReq model.HeartbeatBody
+			if supervisor.LastMessageId != model.DefaultLastMessageId {
+				heartbeatReq.LastMessageId = strconv.Itoa(supervisor.LastMessageId)
+			}
+			request, err := model.BuildRequest(model.Heartbeat, heartbeatReq).GetString()
+			if err != nil {
+				slog.Error("building request", "err", err)
+				continue
+			}
+			err = connection.WriteMessage(websocket.TextMessage, request)
+			if err != nil {
+				slog.Error("sending message", "err", err)
+				return false
+			}
+			slog.Debug("heartbeat", "last_message_id", supervisor.LastMessageId)
+		case <-interrupt:
+			slog.Info("interrupted by user event")
+			err := connection.WriteMessage(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			if err != nil {
+				slog.Error("sending message", "err", err)
+				return true
+			}
+			select {
+			case <-messages:
+			case <-time.After(time.Second):
+			}
+			return true
+		}
+	}
+}
+
+// ReadMessages relays messages from the connection until it fails or stop is closed
+func ReadMessages(connection *websocket.Conn, messages chan []byte, stop chan bool) {
+	defer close(messages)
+	for {
+		_, message, err := connection.ReadMessage()
+		if err != nil {
+			slog.Error("reading message", "err", err)
+			return
+		}
+		select {
+		case messages <- message:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	} else {
+		return b
+	}
+}
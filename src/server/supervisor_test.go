@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/websocket"
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// gatewayStep is what the fake gateway sends on a connection once the bot has identified or resumed
+type gatewayStep struct {
+	expect model.OpType
+	send   []string
+}
+
+type fakeGateway struct {
+	t        *testing.T
+	steps    chan gatewayStep
+	received chan model.MessageModelRaw
+}
+
+func (gateway *fakeGateway) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	connection, err := (&websocket.Upgrader{}).Upgrade(writer, request, nil)
+	if err != nil {
+		gateway.t.Error(err)
+		return
+	}
+	defer connection.Close()
+	step, ok := <-gateway.steps
+	if !ok {
+		return
+	}
+	_ = connection.WriteMessage(websocket.TextMessage, []byte(`{"op":10,"d":{"heartbeat_interval":60000}}`))
+	_, message, err := connection.ReadMessage()
+	if err != nil {
+		gateway.t.Error(err)
+		return
+	}
+	raw, _ := model.GetOpType(message)
+	gateway.received <- raw
+	for _, send := range step.send {
+		_ = connection.WriteMessage(websocket.TextMessage, []byte(send))
+	}
+	// wait for the bot to close the connection
+	for {
+		if _, _, err = connection.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestSupervisorReconnectsAndResumes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	context := env.GetContext()
+	previousToken, previousUser, previousConnection := context.Token, context.User, context.Connection
+	defer func() {
+		log.SetOutput(os.Stderr)
+		context.Token, context.User, context.Connection = previousToken, previousUser, previousConnection
+	}()
+	context.Token = common.Token{AppID: 1024, AccessToken: "token"}
+
+	gateway := &fakeGateway{t: t, steps: make(chan gatewayStep, 8), received: make(chan model.MessageModelRaw, 8)}
+	server := httptest.NewServer(gateway)
+	defer server.Close()
+	supervisor := NewSupervisor(make(chan game.Event, 8))
+	supervisor.MinBackoff = time.Millisecond
+	supervisor.MaxBackoff = 4 * time.Millisecond
+	failures := 2
+	supervisor.Connect = func() error {
+		if failures > 0 {
+			failures -= 1
+			return errors.New("gateway unavailable")
+		}
+		connection, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		context.Connection = connection
+		return err
+	}
+
+	steps := []struct {
+		name    string
+		step    gatewayStep
+		session string
+		seq     int
+	}{
+		{
+			name: "new session is identified, then the server asks to reconnect",
+			step: gatewayStep{expect: model.Identify, send: []string{
+				`{"op":0,"s":1,"t":"READY","d":{"session_id":"session","user":{"id":"bot"}}}`,
+				`{"op":0,"s":5,"t":"GUILD_CREATE","d":{"id":"guild"}}`,
+				`{"op":7}`,
+			}},
+		},
+		{
+			name:    "reconnect resumes, the session is invalidated but resumable",
+			step:    gatewayStep{expect: model.Resume, send: []string{`{"op":9,"d":true}`}},
+			session: "session",
+			seq:     5,
+		},
+		{
+			name:    "resumable session is resumed again, then invalidated for good",
+			step:    gatewayStep{expect: model.Resume, send: []string{`{"op":9,"d":false}`}},
+			session: "session",
+			seq:     5,
+		},
+		{
+			name: "invalidated session is identified again",
+			step: gatewayStep{expect: model.Identify},
+		},
+	}
+	for _, step := range steps {
+		gateway.steps <- step.step
+	}
+	interrupt := make(chan os.Signal, 1)
+	done := make(chan bool)
+	go func() {
+		supervisor.Run(interrupt)
+		close(done)
+	}()
+
+	for _, step := range steps {
+		select {
+		case raw := <-gateway.received:
+			if raw.Op != step.step.expect {
+				t.Fatalf("%s: expected op %d, got %d", step.name, step.step.expect, raw.Op)
+			}
+			if raw.Op == model.Resume {
+				var resume model.ResumeBody
+				if err := json.Unmarshal(raw.Body, &resume); err != nil || resume.SessionId != step.session || resume.Seq != step.seq {
+					t.Fatalf("%s: unexpected resume %s", step.name, raw.Body)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the bot did not connect", step.name)
+		}
+	}
+	interrupt <- os.Interrupt
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("supervisor should stop once interrupted")
+	}
+	if context.User.Id != "bot" {
+		t.Fatalf("ready event should set the bot user, got %+v", context.User)
+	}
+}
+
+func TestSupervisorBacksOffFailedConnections(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	supervisor := NewSupervisor(make(chan game.Event))
+	supervisor.MinBackoff = time.Millisecond
+	supervisor.MaxBackoff = 4 * time.Millisecond
+	interrupt := make(chan os.Signal, 1)
+	attempts := 0
+	supervisor.Connect = func() error {
+		attempts += 1
+		if attempts == 5 {
+			interrupt <- os.Interrupt
+		}
+		return errors.New("gateway unavailable")
+	}
+	supervisor.Run(interrupt)
+	if supervisor.backoff != supervisor.MaxBackoff {
+		t.Fatalf("backoff should double up to its maximum, got %v", supervisor.backoff)
+	}
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"halligalli/common"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/model"
+	"halligalli/render"
+	"log/slog"
+	"sort"
+)
+
+// MessageKeys are the keys of the templates of each message type in the locale catalog
+var MessageKeys = map[game.MessageType]string{
+	game.ShowGameRule:     "show_game_rule",
+	game.CardRevealed:     "card_revealed",
+	game.PlayerWin:        "player_win",
+	game.FakeRing:         "fake_ring",
+	game.Terminated:       "terminated",
+	game.ExplainWhy:       "explain_why",
+	game.ShowScore:        "show_score",
+	game.NotEnoughPlayers: "not_enough_players",
+	game.ShowHands:        "show_hands",
+	game.PlayerEliminated: "player_eliminated",
+	game.GameOver:         "game_over",
+	game.ShowRoster:       "show_roster",
+	game.AlreadyJoined:    "already_joined",
+	game.LobbyFull:        "lobby_full",
+	game.ShowRule:         "show_rule",
+	game.InvalidRule:      "invalid_rule",
+	game.ShowStats:        "show_stats",
+	game.ShowDeck:         "show_deck",
+}
+
+// ModeKeys suffix the key of the rules shown for each game mode
+var ModeKeys = map[game.Mode]string{
+	game.Classic:  "classic",
+	game.Tabletop: "tabletop",
+}
+
+// MessageData is what the templates can use, Param is the param of the message
+type MessageData struct {
+	Rule    common.Rule
+	Mode    game.Mode
+	Players []model.User
+	// Locale is the locale the message is written in
+	Locale string
+	// Decks are the names of the deck profiles a channel can choose
+	Decks []string
+	Param any
+}
+
+// Explanation is the param of ExplainWhy, counting what the cards checked for the bell hold
+type Explanation struct {
+	Cards []common.Card
+	// Fruits are ordered by variant
+	Fruits  []FruitCount
+	Animals []int
+}
+
+type FruitCount struct {
+	Variant int
+	Number  int
+}
+
+func Explain(cards []common.Card) Explanation {
+	explanation := Explanation{Cards: cards}
+	fruitCounter := make(map[int]int)
+	for _, card := range cards {
+		if card.Type == common.Animal {
+			explanation.Animals = append(explanation.Animals, card.Variant)
+			continue
+		}
+		for _, fruit := range card.Elements {
+			fruitCounter[fruit.Variant] += fruit.Number
+		}
+	}
+	for variant, number := range fruitCounter {
+		explanation.Fruits = append(explanation.Fruits, FruitCount{Variant: variant, Number: number})
+	}
+	sort.Slice(explanation.Fruits, func(i, j int) bool {
+		return explanation.Fruits[i].Variant < explanation.Fruits[j].Variant
+	})
+	return explanation
+}
+
+func MessageKey(message game.Message) string {
+	key := MessageKeys[message.MessageType]
+	if message.MessageType == game.ShowGameRule {
+		key += "." + ModeKeys[message.Param.(game.Mode)]
+	}
+	return key
+}
+
+// RenderMessage writes the message in the locale with the template of its type
+func RenderMessage(message game.Message, name string) (string, error) {
+	data := MessageData{
+		Rule:    message.Rule,
+		Mode:    message.Mode,
+		Players: message.Players,
+		Param:   message.Param,
+	}
+	if message.MessageType == game.ExplainWhy {
+		data.Param = Explain(message.Param.([]common.Card))
+	}
+	return RenderKey(MessageKey(message), data, name)
+}
+
+// RenderKey writes the template of the key in the locale
+func RenderKey(key string, data MessageData, name string) (string, error) {
+	if locale.DefaultCatalog == nil {
+		return "", errors.New("no locale catalog loaded")
+	}
+	data.Locale = name
+	data.Decks = game.DeckProfileNames()
+	return locale.DefaultCatalog.Render(name, key, data)
+}
+
+// WriteMessage writes the message in the locale, in the fallback locale if its template fails,
+// and at last as a built-in text, so that a broken template never leaves the channel without the message
+func WriteMessage(message game.Message, name string) string {
+	content, err := RenderMessage(message, name)
+	if err == nil {
+		return content
+	}
+	slog.Error("writing message", "key", MessageKey(message), "locale", name, "err", err)
+	if catalog := locale.DefaultCatalog; catalog != nil && catalog.Fallback != name {
+		if content, err = RenderMessage(message, catalog.Fallback); err == nil {
+			return content
+		}
+		slog.Error("writing message", "key", MessageKey(message), "locale", catalog.Fallback, "err", err)
+	}
+	return BuiltinText(message)
+}
+
+// BuiltinText is the message written without templates, revealed cards are shown as they are
+func BuiltinText(message game.Message) string {
+	if revealed, ok := message.Param.(game.RevealedCard); ok {
+		if len(revealed.Window) == 0 {
+			return render.CardText(revealed.Card, render.AssetName)
+		}
+		return render.BoardText(revealed.Window, render.AssetName)
+	}
+	return fmt.Sprintf("[%s]", MessageKey(message))
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"halligalli/common"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/locale"
+	"halligalli/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadCatalog(t *testing.T) {
+	catalog, err := locale.LoadCatalog("../assets/locales")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locale.DefaultCatalog = catalog
+	env.GetContext().Asset.Meta = common.AssetMeta{
+		Fruits:  []common.AssetVariant{{Name: "草莓", Variant: 1, Emoji: "🍓"}, {Name: "青梨", Variant: 2, Emoji: "🍐"}},
+		Animals: []common.AssetVariant{{Name: "熊猫", Variant: 5, Emoji: "🐼"}},
+	}
+}
+
+func TestEveryMessageIsWrittenInEveryLocale(t *testing.T) {
+	loadCatalog(t)
+	player := model.User{Id: "player"}
+	rule := common.Rule{ValidCardNumber: 4, FruitNumberToWin: 6, DealInterval: 5 * time.Second}
+	fruit := common.Card{Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 2}, {Variant: 2, Number: 1}}}
+	panda := common.Card{Type: common.Animal, Variant: 5}
+	roster := game.RosterStatus{Players: []model.User{player}, MinPlayers: 2, MaxPlayers: 4}
+	params := map[game.MessageType][]any{
+		game.ShowGameRule: {game.Classic, game.Tabletop},
+		game.CardRevealed: {game.RevealedCard{Card: panda, Window: []common.Card{fruit, panda}}},
+		game.PlayerWin: {
+			game.RoundStatus{IsWin: true, Player: player, Fruit: 1, Score: 10, ScoreChange: 10, Reaction: time.Second,
+				RunnersUp: []game.RunnerUp{{Player: model.User{Id: "other"}, Gap: time.Second / 4}}},
+			game.RoundStatus{IsWin: true, Player: player, Animal: 5, Score: 10, ScoreChange: 10, Reaction: -1},
+		},
+		game.FakeRing:         {game.RoundStatus{Player: player, Score: -5, ScoreChange: -5}},
+		game.Terminated:       {nil},
+		game.ExplainWhy:       {[]common.Card{fruit, {Type: common.Fruit}, panda}, []common.Card{}},
+		game.ShowScore:        {[]game.PlayerScore{{Player: player, Score: 10, Wins: 1}}, []game.PlayerScore{}},
+		game.NotEnoughPlayers: {roster},
+		game.ShowHands:        {[]game.HandStatus{{Player: player, Cards: 12}}},
+		game.PlayerEliminated: {player},
+		game.GameOver:         {player},
+		game.ShowRoster:       {roster, game.RosterStatus{}},
+		game.AlreadyJoined:    {player},
+		game.LobbyFull:        {roster},
+		game.ShowRule:         {rule},
+		game.InvalidRule: {
+			game.RuleError{Reason: game.RuleLocked},
+			game.RuleError{Reason: game.RuleLocked, Key: "deck"},
+			game.RuleError{Reason: game.UnknownRuleKey, Key: "speed"},
+			game.RuleError{Reason: game.RuleOutOfRange, Key: "window", Min: 1, Max: 10},
+			game.RuleError{Reason: game.InvalidRuleValue, Key: "locale", Value: "fr"},
+		},
+		game.ShowDeck: {
+			game.DeckReport{Profile: "kids", Cards: 40, Fruits: map[int]int{1: 20, 2: 18}, Animals: 16, Unreachable: []int{2}},
+			game.DeckReport{Profile: "no-animals", Fruits: map[int]int{}},
+		},
+		game.ShowStats: {[]game.PlayerStats{{Player: player, Reactions: 2, Total: time.Second, Best: time.Second / 4}}, []game.PlayerStats{}},
+	}
+	for messageType, key := range MessageKeys {
+		if len(params[messageType]) == 0 {
+			t.Errorf("no test for message %s", key)
+		}
+	}
+
+	for _, name := range locale.Shipped {
+		for messageType, messageParams := range params {
+			for _, param := range messageParams {
+				message := game.Message{MessageType: messageType, Param: param, Rule: rule, Players: []model.User{player}}
+				if !locale.DefaultCatalog.HasMessage(name, MessageKey(message)) {
+					t.Errorf("locale %s has no message %s", name, MessageKey(message))
+				}
+				text, err := RenderMessage(message, name)
+				if err != nil || text == "" || strings.Contains(text, "<no value>") {
+					t.Errorf("message %s in %s with %+v: %q, %v", MessageKey(message), name, param, text, err)
+				}
+			}
+		}
+	}
+}
+
+func TestMessagesFollowTheRule(t *testing.T) {
+	loadCatalog(t)
+	rule := common.Rule{ValidCardNumber: 4, FruitNumberToWin: 6}
+	text, err := RenderMessage(game.Message{MessageType: game.ShowGameRule, Param: game.Classic, Rule: rule}, locale.Chinese)
+	if err != nil || !strings.Contains(text, "最后 4 张牌中有 6 个相同的水果") {
+		t.Fatalf("rules should follow the rule of the channel, got %q, %v", text, err)
+	}
+
+	win := game.RoundStatus{Player: model.User{Id: "player"}, Fruit: 1, ScoreChange: 10, Score: 20, Reaction: 1500 * time.Millisecond}
+	text, err = RenderMessage(game.Message{MessageType: game.PlayerWin, Param: win, Rule: rule}, locale.English)
+	if err != nil || !strings.Contains(text, "the last 4 cards show 6 × strawberry, reaction time 1.50s") {
+		t.Fatalf("unexpected english win message %q, %v", text, err)
+	}
+	text, err = RenderMessage(game.Message{MessageType: game.PlayerWin, Param: win, Rule: rule}, locale.Chinese)
+	if err != nil || !strings.Contains(text, "（最后 4 张牌中有 6 个草莓，反应时间 1.50 秒）") {
+		t.Fatalf("unexpected chinese win message %q, %v", text, err)
+	}
+
+	revealed := game.RevealedCard{
+		Card:   common.Card{Type: common.Animal, Variant: 5},
+		Window: []common.Card{{Type: common.Fruit, Elements: []common.CardElement{{Variant: 1, Number: 2}}}, {Type: common.Animal, Variant: 5}},
+	}
+	text, err = RenderMessage(game.Message{MessageType: game.CardRevealed, Param: revealed}, locale.English)
+	if err != nil || text != "Revealed 🐼 panda\nTable: 🍓🍓 | 🐼 panda" {
+		t.Fatalf("unexpected card text %q, %v", text, err)
+	}
+}
+
+func TestDeckMessagesListEveryProfile(t *testing.T) {
+	loadCatalog(t)
+	messages := []game.Message{
+		{MessageType: game.ShowDeck, Param: game.DeckReport{Profile: game.DefaultDeckProfile, Fruits: map[int]int{}}},
+		{MessageType: game.InvalidRule, Param: game.RuleError{Reason: game.InvalidRuleValue, Key: "deck", Value: "jumbo"}},
+	}
+	for _, name := range locale.Shipped {
+		for _, message := range messages {
+			text, err := RenderMessage(message, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, profile := range game.DeckProfileNames() {
+				if !strings.Contains(text, profile) {
+					t.Errorf("message %s in %s should list deck %s: %q", MessageKey(message), name, profile, text)
+				}
+			}
+		}
+	}
+}
+
+func TestBrokenTemplateFallsBack(t *testing.T) {
+	loadCatalog(t)
+	defer loadCatalog(t)
+	broken := locale.File{Messages: map[string]string{"card_revealed": "{{.Param.Missing}}", "terminated": "{{.Missing}}"}}
+	if err := locale.DefaultCatalog.Add(locale.English, broken); err != nil {
+		t.Fatal(err)
+	}
+	panda := common.Card{Type: common.Animal, Variant: 5}
+	message := game.Message{MessageType: game.CardRevealed, Param: game.RevealedCard{Card: panda, Window: []common.Card{panda}}}
+	if text := WriteMessage(message, locale.English); text != "翻开了 🐼 熊猫" {
+		t.Fatalf("broken message should be written in the fallback locale, got %q", text)
+	}
+
+	if err := locale.DefaultCatalog.Add(locale.Chinese, broken); err != nil {
+		t.Fatal(err)
+	}
+	if text := WriteMessage(message, locale.English); text != "🐼 熊猫" {
+		t.Fatalf("card should still be shown without templates, got %q", text)
+	}
+	if text := WriteMessage(game.Message{MessageType: game.Terminated}, locale.Chinese); text != "[terminated]" {
+		t.Fatalf("message should still be sent without templates, got %q", text)
+	}
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"halligalli/game"
+	"halligalli/model"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SignatureHeader          = "X-Signature-Ed25519"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	MaxWebhookBodySize       = 1 << 20
+	// MaxSignatureAge rejects requests signed too long ago or ahead, so that a captured request cannot be replayed later
+	MaxSignatureAge = 5 * time.Minute
+	// FetchBotUserAttempts is how many times the bot user is fetched before the webhook server gives up starting
+	FetchBotUserAttempts = 5
+)
+
+// WebhookServer receives events as HTTP callbacks instead of through the websocket gateway,
+// every request must be signed with the key derived from the bot secret
+type WebhookServer struct {
+	Address string
+	Events  *EventDispatcher
+	// FetchUser loads the bot user, retried from MinBackoff when it fails
+	FetchUser  func() error
+	MinBackoff time.Duration
+	Seen       *SeenEvents
+	key        ed25519.PrivateKey
+}
+
+func NewWebhookServer(address string, secret string, eventChannel chan game.Event) (*WebhookServer, error) {
+	key, err := DeriveSigningKey(secret)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookServer{
+		Address:    address,
+		Events:     NewGameEventDispatcher(eventChannel),
+		FetchUser:  FetchBotUser,
+		MinBackoff: MinRetryBackoff,
+		Seen:       NewSeenEvents(),
+		key:        key,
+	}, nil
+}
+
+// DeriveSigningKey uses the bot secret repeated to the seed size as the ed25519 seed
+func DeriveSigningKey(secret string) (ed25519.PrivateKey, error) {
+	if secret == "" {
+		return nil, errors.New("no bot secret to verify webhook requests with")
+	}
+	seed := strings.Repeat(secret, ed25519.SeedSize/len(secret)+1)[:ed25519.SeedSize]
+	return ed25519.NewKeyFromSeed([]byte(seed)), nil
+}
+
+func Sign(key ed25519.PrivateKey, timestamp string, body []byte) string {
+	return hex.EncodeToString(ed25519.Sign(key, append([]byte(timestamp), body...)))
+}
+
+func VerifySignature(key ed25519.PrivateKey, signature string, timestamp string, body []byte) bool {
+	raw, err := hex.DecodeString(signature)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return false
+	}
+	public := key.Public().(ed25519.PublicKey)
+	return ed25519.Verify(public, append([]byte(timestamp), body...), raw)
+}
+
+// IsRecent reports whether the timestamp, in unix seconds, is within MaxSignatureAge of now
+func IsRecent(timestamp string, now time.Time) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	return age <= MaxSignatureAge && age >= -MaxSignatureAge
+}
+
+// SeenEvents remembers the events handled within twice MaxSignatureAge, the time a signed request
+// is accepted for, so that a request replayed while it is still recent is not handled again
+type SeenEvents struct {
+	lock  sync.Mutex
+	ids   map[string]time.Time
+	order []string
+}
+
+func NewSeenEvents() *SeenEvents {
+	return &SeenEvents{ids: make(map[string]time.Time)}
+}
+
+// Add reports whether the event is seen for the first time and remembers it
+func (seen *SeenEvents) Add(id string, now time.Time) bool {
+	seen.lock.Lock()
+	defer seen.lock.Unlock()
+	// events are added in the order they are received, so the oldest ones expire first
+	for len(seen.order) > 0 && now.Sub(seen.ids[seen.order[0]]) > 2*MaxSignatureAge {
+		delete(seen.ids, seen.order[0])
+		seen.order = seen.order[1:]
+	}
+	if _, ok := seen.ids[id]; ok {
+		return false
+	}
+	seen.ids[id] = now
+	seen.order = append(seen.order, id)
+	return true
+}
+
+// fetchBotUser retries to load the bot user with a doubling backoff, as no mention
+// of the bot can be recognized without its user id
+func (server *WebhookServer) fetchBotUser() error {
+	backoff := server.MinBackoff
+	for attempt := 1; ; attempt++ {
+		err := server.FetchUser()
+		if err == nil {
+			return nil
+		}
+		if attempt == FetchBotUserAttempts {
+			return fmt.Errorf("fetching bot user after %d attempts: %w", attempt, err)
+		}
+		slog.Error("fetching bot user, retrying", "attempt", attempt, "backoff", backoff, "err", err)
+		time.Sleep(backoff)
+		backoff = minDuration(backoff*2, MaxRetryBackoff)
+	}
+}
+
+// Run blocks until the interrupt signal is received or the server fails,
+// it fails without serving when the bot user cannot be fetched
+func (server *WebhookServer) Run(interrupt chan os.Signal) error {
+	if err := server.fetchBotUser(); err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr:              server.Address,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-interrupt
+		slog.Info("interrupted by user event")
+		shutdown, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdown); err != nil {
+			slog.Error("shutting down webhook server", "err", err)
+		}
+	}()
+	slog.Info("listening for webhook events", "address", server.Address)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (server *WebhookServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, MaxWebhookBodySize))
+	if err != nil {
+		slog.Error("reading webhook request", "err", err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	signature := request.Header.Get(SignatureHeader)
+	timestamp := request.Header.Get(SignatureTimestampHeader)
+	if !VerifySignature(server.key, signature, timestamp, body) {
+		slog.Error("webhook request with invalid signature")
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !IsRecent(timestamp, time.Now()) {
+		slog.Error("webhook request signed too long ago or ahead, it may be replayed", "timestamp", timestamp)
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	slog.Debug("receive", "body", body)
+	raw, err := model.GetOpType(body)
+	if err != nil {
+		slog.Error("getting operation type", "err", err)
+		writer.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch raw.Op {
+	case model.CallbackValidation:
+		validation, err := model.ParseValidationBody(raw.Body)
+		if err != nil {
+			slog.Error("parsing validation body", "err", err)
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		writeJson(writer, model.ValidationResponseBody{
+			PlainToken: validation.PlainToken,
+			Signature:  Sign(server.key, validation.EventTs, []byte(validation.PlainToken)),
+		})
+	case model.Dispatch:
+		// the signature stands for an event without id, a replayed request carries the same one
+		id := raw.Id
+		if id == "" {
+			id = signature
+		}
+		if !server.Seen.Add(id, time.Now()) {
+			slog.Info("ignored event delivered again", "id", id)
+			writeJson(writer, model.BuildRequest(model.HttpCallback, 0))
+			return
+		}
+		if err := server.Events.Dispatch(raw.Intent, raw.Body); err != nil {
+			slog.Error("handling event", "intent", raw.Intent, "err", err)
+		}
+		writeJson(writer, model.BuildRequest(model.HttpCallback, 0))
+	default:
+		slog.Info("unsupported webhook operation", "op", raw.Op)
+		writeJson(writer, model.BuildRequest(model.HttpCallback, 0))
+	}
+}
+
+func writeJson(writer http.ResponseWriter, body any) {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("building response", "err", err)
+		writer.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	if _, err = writer.Write(raw); err != nil {
+		slog.Error("writing response", "err", err)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"halligalli/env"
+	"halligalli/game"
+	"halligalli/model"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testSecret = "DG5g3B4j9X2KOErG"
+
+func postSigned(handler http.Handler, key []byte, timestamp string, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	request.Header.Set(SignatureTimestampHeader, timestamp)
+	if key != nil {
+		request.Header.Set(SignatureHeader, Sign(key, timestamp, body))
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func newWebhookServer(t *testing.T, eventChannel chan game.Event) *WebhookServer {
+	server, err := NewWebhookServer(":0", testSecret, eventChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func signedNow() string {
+	return strconv.FormatInt(time.Now().Unix(), 10)
+}
+
+func TestWebhookAnswersValidation(t *testing.T) {
+	server := newWebhookServer(t, make(chan game.Event, 1))
+	body := []byte(`{"op":13,"d":{"plain_token":"Arq0D5A61EgUu4OxUvOp","event_ts":"1725442341"}}`)
+	recorder := postSigned(server, server.key, signedNow(), body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("validation failed with status %d", recorder.Code)
+	}
+	var response model.ValidationResponseBody
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	// example from the OpenAPI documentation
+	expected := "87befc99c42c651b3aac0278e71ada338433ae26fcb24307bdc5ad38c1adc2d0" +
+		"1bcfcadc0842edac85e85205028a1132afe09280305f13aa6909ffc2d652c706"
+	if response.PlainToken != "Arq0D5A61EgUu4OxUvOp" || response.Signature != expected {
+		t.Fatalf("unexpected validation response %+v", response)
+	}
+}
+
+func TestWebhookRejectsInvalidSignatures(t *testing.T) {
+	server := newWebhookServer(t, make(chan game.Event, 1))
+	body := []byte(`{"op":0,"t":"MESSAGE_CREATE","d":{}}`)
+	if recorder := postSigned(server, nil, signedNow(), body); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("unsigned request should be rejected, got %d", recorder.Code)
+	}
+	other, err := DeriveSigningKey("another secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder := postSigned(server, other, signedNow(), body); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("request signed by another key should be rejected, got %d", recorder.Code)
+	}
+	request := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	request.Header.Set(SignatureTimestampHeader, signedNow())
+	request.Header.Set(SignatureHeader, Sign(server.key, "1725442341", body))
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("request with another timestamp should be rejected, got %d", recorder.Code)
+	}
+
+	// a request signed long ago is a replay even with a valid signature
+	old := strconv.FormatInt(time.Now().Add(-MaxSignatureAge-time.Minute).Unix(), 10)
+	if recorder := postSigned(server, server.key, old, body); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed request should be rejected, got %d", recorder.Code)
+	}
+	if recorder := postSigned(server, server.key, "yesterday", body); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("request without a unix timestamp should be rejected, got %d", recorder.Code)
+	}
+}
+
+func TestDeriveSigningKeyRejectsEmptySecret(t *testing.T) {
+	if _, err := DeriveSigningKey(""); err == nil {
+		t.Fatalf("empty secret should be rejected")
+	}
+	if _, err := NewWebhookServer(":0", "", make(chan game.Event)); err == nil {
+		t.Fatalf("webhook server without secret should not start")
+	}
+	if key, err := DeriveSigningKey("s"); err != nil || len(key) != ed25519.PrivateKeySize {
+		t.Fatalf("short secret should be repeated to a full seed, got %v", err)
+	}
+}
+
+func TestWebhookFeedsMessageEvents(t *testing.T) {
+	env.GetContext().User = model.User{Id: "bot"}
+	eventChannel := make(chan game.Event, 1)
+	server := newWebhookServer(t, eventChannel)
+	body := []byte(`{"op":0,"s":3,"t":"MESSAGE_CREATE","d":{"id":"message","channel_id":"channel",` +
+		`"content":"<@!bot> start","author":{"id":"player"},"mentions":[{"id":"bot"}]}}`)
+	recorder := postSigned(server, server.key, signedNow(), body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("event rejected with status %d", recorder.Code)
+	}
+	var ack model.MessageModel
+	if err := json.Unmarshal(recorder.Body.Bytes(), &ack); err != nil || ack.Op != model.HttpCallback {
+		t.Fatalf("event should be acknowledged, got %s", recorder.Body.String())
+	}
+	select {
+	case event := <-eventChannel:
+		if event.EventType != game.Start || event.ChannelId != "channel" || event.MessageId != "message" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("event was not fed to the game")
+	}
+}
+
+func TestWebhookIgnoresReplayedEvents(t *testing.T) {
+	env.GetContext().User = model.User{Id: "bot"}
+	eventChannel := make(chan game.Event, 2)
+	server := newWebhookServer(t, eventChannel)
+	body := []byte(`{"id":"MESSAGE_CREATE:1","op":0,"s":4,"t":"MESSAGE_CREATE","d":{"id":"message","channel_id":"channel",` +
+		`"content":"<@!bot> stop","author":{"id":"player"},"mentions":[{"id":"bot"}]}}`)
+	timestamp := signedNow()
+	for attempt := 0; attempt < 2; attempt++ {
+		if recorder := postSigned(server, server.key, timestamp, body); recorder.Code != http.StatusOK {
+			t.Fatalf("event rejected with status %d", recorder.Code)
+		}
+	}
+	if len(eventChannel) != 1 {
+		t.Fatalf("replayed event should be handled once, got %d events", len(eventChannel))
+	}
+
+	// the event is forgotten once no request carrying it can be recent anymore
+	seen := NewSeenEvents()
+	start := time.Now()
+	if !seen.Add("event", start) || seen.Add("event", start.Add(2*MaxSignatureAge)) {
+		t.Fatalf("event should be seen within the signature window")
+	}
+	if !seen.Add("event", start.Add(2*MaxSignatureAge+time.Second)) {
+		t.Fatalf("event should expire after the signature window")
+	}
+}
+
+func TestWebhookRetriesFetchingBotUser(t *testing.T) {
+	server := newWebhookServer(t, make(chan game.Event))
+	server.MinBackoff = time.Millisecond
+	attempts := 0
+	server.FetchUser = func() error {
+		attempts += 1
+		if attempts < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+	if err := server.fetchBotUser(); err != nil || attempts != 3 {
+		t.Fatalf("bot user should be fetched on the third attempt, got %d attempts: %v", attempts, err)
+	}
+
+	attempts = 0
+	server.FetchUser = func() error {
+		attempts += 1
+		return errors.New("unavailable")
+	}
+	if err := server.Run(make(chan os.Signal)); err == nil || attempts != FetchBotUserAttempts {
+		t.Fatalf("server should not start without the bot user, got %d attempts: %v", attempts, err)
+	}
+}
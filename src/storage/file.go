@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultDir       = "./data"
+	GamesFileName    = "games.jsonl"
+	ProfilesFileName = "profiles.json"
+	GuildsFileName   = "guilds.json"
+	SnapshotsDirName = "snapshots"
+)
+
+// FileStore keeps everything as JSON files under a single directory:
+// finished games are appended line by line, profiles and guilds are kept in one file each
+// and every unfinished game has its own snapshot file
+type FileStore struct {
+	Dir      string
+	lock     sync.Mutex
+	profiles map[string]PlayerProfile
+	guilds   map[string]GuildSettings
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, SnapshotsDirName), 0755); err != nil {
+		return nil, err
+	}
+	store := &FileStore{
+		Dir:      dir,
+		profiles: make(map[string]PlayerProfile),
+		guilds:   make(map[string]GuildSettings),
+	}
+	if err := readJsonFile(filepath.Join(dir, ProfilesFileName), &store.profiles); err != nil {
+		return nil, err
+	}
+	if err := readJsonFile(filepath.Join(dir, GuildsFileName), &store.guilds); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// readJsonFile leaves the value untouched if the file does not exist
+func readJsonFile(name string, value any) error {
+	content, err := os.ReadFile(name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(content) > 0 {
+		return json.Unmarshal(content, value)
+	}
+	return nil
+}
+
+func (store *FileStore) SaveGame(record GameRecord) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(store.Dir, GamesFileName), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	// start a new line if the last game was truncated, so that this one is not lost along with it
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			line = append([]byte{'\n'}, line...)
+		}
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (store *FileStore) LoadGames() ([]GameRecord, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	records := make([]GameRecord, 0)
+	file, err := os.Open(filepath.Join(store.Dir, GamesFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record GameRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// a crash while appending a game leaves its line truncated, the other games are still fine
+			slog.Error("skipped unreadable line", "line", line, "file", GamesFileName, "err", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// SaveProfile rewrites the whole profile file, which takes a few milliseconds for thousands of players.
+// Profiles change a few times per round, a store with many more players should keep them in a database instead
+func (store *FileStore) SaveProfile(profile PlayerProfile) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.saveProfile(profile)
+}
+
+func (store *FileStore) UpdateProfile(id string, update func(profile *PlayerProfile)) (PlayerProfile, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	profile, ok := store.profiles[id]
+	if !ok {
+		profile = PlayerProfile{Id: id}
+	}
+	update(&profile)
+	return profile, store.saveProfile(profile)
+}
+
+func (store *FileStore) saveProfile(profile PlayerProfile) error {
+	store.profiles[profile.Id] = profile
+	content, err := json.MarshalIndent(store.profiles, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(store.Dir, ProfilesFileName), content)
+}
+
+func (store *FileStore) GetProfile(id string) (PlayerProfile, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	profile, ok := store.profiles[id]
+	return profile, ok, nil
+}
+
+func (store *FileStore) SaveGuild(guild GuildSettings) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	store.guilds[guild.Id] = guild
+	content, err := json.MarshalIndent(store.guilds, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(store.Dir, GuildsFileName), content)
+}
+
+func (store *FileStore) GetGuild(id string) (GuildSettings, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	guild, ok := store.guilds[id]
+	return guild, ok, nil
+}
+
+func (store *FileStore) SaveSnapshot(channelId string, snapshot []byte) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return writeFileAtomic(store.snapshotPath(channelId), snapshot)
+}
+
+func (store *FileStore) LoadSnapshot(channelId string) ([]byte, bool, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	content, err := os.ReadFile(store.snapshotPath(channelId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+func (store *FileStore) DeleteSnapshot(channelId string) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	err := os.Remove(store.snapshotPath(channelId))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (store *FileStore) LoadSnapshots() (map[string][]byte, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	entries, err := os.ReadDir(filepath.Join(store.Dir, SnapshotsDirName))
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make(map[string][]byte)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		channelId, err := url.PathUnescape(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(store.Dir, SnapshotsDirName, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		snapshots[channelId] = content
+	}
+	return snapshots, nil
+}
+
+func (store *FileStore) snapshotPath(channelId string) string {
+	return filepath.Join(store.Dir, SnapshotsDirName, url.PathEscape(channelId)+".json")
+}
+
+// writeFileAtomic replaces the file in one step so that a crash never leaves it half written
+func writeFileAtomic(name string, content []byte) error {
+	temp := name + ".tmp"
+	if err := os.WriteFile(temp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, name)
+}
@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newStore(t *testing.T, dir string) *FileStore {
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	store := newStore(t, t.TempDir())
+	if _, ok, err := store.LoadSnapshot("channel/1"); ok || err != nil {
+		t.Fatalf("missing snapshot should not be found, got %t %v", ok, err)
+	}
+	if err := store.SaveSnapshot("channel/1", []byte(`{"round":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapshot("channel/1", []byte(`{"round":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapshot("other", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot, ok, err := store.LoadSnapshot("channel/1"); !ok || err != nil || string(snapshot) != `{"round":2}` {
+		t.Fatalf("snapshot should be the last one saved, got %s %t %v", snapshot, ok, err)
+	}
+	snapshots, err := store.LoadSnapshots()
+	if err != nil || len(snapshots) != 2 || string(snapshots["channel/1"]) != `{"round":2}` {
+		t.Fatalf("every snapshot should be loaded by channel, got %v %v", snapshots, err)
+	}
+
+	if err = store.DeleteSnapshot("channel/1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = store.DeleteSnapshot("channel/1"); err != nil {
+		t.Fatalf("deleting a missing snapshot should succeed, got %v", err)
+	}
+	if snapshots, err = store.LoadSnapshots(); err != nil || len(snapshots) != 1 || snapshots["other"] == nil {
+		t.Fatalf("only the other snapshot should be left, got %v %v", snapshots, err)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.json")
+	if err := writeFileAtomic(name, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(name); string(content) != "second" {
+		t.Fatalf("file should be replaced, got %q", content)
+	}
+	if _, err := os.Stat(name + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary file should be renamed, got %v", err)
+	}
+
+	// the temporary file cannot be written, the file keeps its content
+	if err := os.Mkdir(name+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name, []byte("third")); err == nil {
+		t.Fatalf("write should fail")
+	}
+	if content, _ := os.ReadFile(name); string(content) != "second" {
+		t.Fatalf("failed write should leave the file alone, got %q", content)
+	}
+}
+
+func TestProfilesAndGuildsAreReloaded(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(t, dir)
+	if err := store.SaveProfile(PlayerProfile{Id: "alice", UserName: "Alice", Wins: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.UpdateProfile("bob", func(profile *PlayerProfile) { profile.Score += 10 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveGuild(GuildSettings{Id: "guild", Locale: "en"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newStore(t, dir)
+	if profile, ok, _ := reopened.GetProfile("alice"); !ok || profile.UserName != "Alice" || profile.Wins != 2 {
+		t.Fatalf("profile should be reloaded, got %+v %t", profile, ok)
+	}
+	if profile, ok, _ := reopened.GetProfile("bob"); !ok || profile.Id != "bob" || profile.Score != 10 {
+		t.Fatalf("updated profile should be reloaded, got %+v %t", profile, ok)
+	}
+	if guild, ok, _ := reopened.GetGuild("guild"); !ok || guild.Locale != "en" {
+		t.Fatalf("guild should be reloaded, got %+v %t", guild, ok)
+	}
+	if _, ok, _ := reopened.GetProfile("carol"); ok {
+		t.Fatalf("unknown player should have no profile")
+	}
+}
+
+func TestUpdateProfileDoesNotLoseUpdates(t *testing.T) {
+	store := newStore(t, t.TempDir())
+	var group sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			if _, err := store.UpdateProfile("alice", func(profile *PlayerProfile) { profile.Score += 1 }); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	group.Wait()
+	if profile, _, _ := store.GetProfile("alice"); profile.Score != 20 {
+		t.Fatalf("every update should count, got %+v", profile)
+	}
+}
+
+func TestLoadGamesSkipsTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(t, dir)
+	if records, err := store.LoadGames(); err != nil || len(records) != 0 {
+		t.Fatalf("no game should be loaded yet, got %v %v", records, err)
+	}
+	for _, channelId := range []string{"a", "b"} {
+		if err := store.SaveGame(GameRecord{ChannelId: channelId, StartedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file, err := os.OpenFile(filepath.Join(dir, GamesFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.WriteString(`{"channel_id":"c","mode":`); err != nil {
+		t.Fatal(err)
+	}
+	_ = file.Close()
+
+	records, err := store.LoadGames()
+	if err != nil || len(records) != 2 || records[0].ChannelId != "a" || records[1].ChannelId != "b" {
+		t.Fatalf("complete games should be loaded, got %+v %v", records, err)
+	}
+
+	// the next game starts on a line of its own
+	if err = store.SaveGame(GameRecord{ChannelId: "d"}); err != nil {
+		t.Fatal(err)
+	}
+	records, err = store.LoadGames()
+	if err != nil || len(records) != 3 || records[2].ChannelId != "d" {
+		t.Fatalf("game saved after the truncated one should be loaded, got %+v %v", records, err)
+	}
+}
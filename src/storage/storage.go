@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"time"
+)
+
+// Store keeps finished games, player profiles, guild settings and snapshots of unfinished games across restarts
+type Store interface {
+	SaveGame(record GameRecord) error
+	LoadGames() ([]GameRecord, error)
+	SaveProfile(profile PlayerProfile) error
+	// GetProfile returns false if the player has no profile yet
+	GetProfile(id string) (PlayerProfile, bool, error)
+	// UpdateProfile applies the update to the profile of the player, a new one if it has none,
+	// without letting another update of the same store slip in between
+	UpdateProfile(id string, update func(profile *PlayerProfile)) (PlayerProfile, error)
+	SaveGuild(guild GuildSettings) error
+	// GetGuild returns false if the guild has no settings yet
+	GetGuild(id string) (GuildSettings, bool, error)
+	SaveSnapshot(channelId string, snapshot []byte) error
+	// LoadSnapshot returns false if the channel has no snapshot
+	LoadSnapshot(channelId string) ([]byte, bool, error)
+	DeleteSnapshot(channelId string) error
+	LoadSnapshots() (map[string][]byte, error)
+}
+
+type GameRecord struct {
+	ChannelId string        `json:"channel_id"`
+	Mode      int           `json:"mode"`
+	StartedAt time.Time     `json:"started_at"`
+	EndedAt   time.Time     `json:"ended_at"`
+	Rounds    []RoundRecord `json:"rounds"`
+	Scores    []ScoreRecord `json:"scores"`
+}
+
+type RoundRecord struct {
+	Number   int          `json:"number"`
+	PlayerId string       `json:"player_id"`
+	IsWin    bool         `json:"is_win"`
+	Animal   string       `json:"animal,omitempty"`
+	Fruit    string       `json:"fruit,omitempty"`
+	Rings    []RingRecord `json:"rings"`
+	EndedAt  time.Time    `json:"ended_at"`
+}
+
+type RingRecord struct {
+	PlayerId  string    `json:"player_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Seq       int       `json:"seq"`
+}
+
+type ScoreRecord struct {
+	PlayerId  string `json:"player_id"`
+	Score     int    `json:"score"`
+	Wins      int    `json:"wins"`
+	FakeRings int    `json:"fake_rings"`
+}
+
+type PlayerProfile struct {
+	Id            string        `json:"id"`
+	UserName      string        `json:"username"`
+	Games         int           `json:"games"`
+	Wins          int           `json:"wins"`
+	FakeRings     int           `json:"fake_rings"`
+	Score         int           `json:"score"`
+	Reactions     int           `json:"reactions"`
+	ReactionTotal time.Duration `json:"reaction_total"`
+	ReactionBest  time.Duration `json:"reaction_best"`
+}
+
+// GuildSettings apply to every channel of the guild that has no setting of its own
+type GuildSettings struct {
+	Id     string `json:"id"`
+	Locale string `json:"locale,omitempty"`
+}